@@ -0,0 +1,149 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/limetext/backend/log"
+)
+
+type (
+	// clipboard connects the editor's clipboard to the host's. Which way
+	// is used is picked with the clipboard_provider setting:
+	//
+	//     "auto"     a clipboard tool if one works here, else OSC 52
+	//     "tool"     wl-copy, xclip, xsel or pbcopy
+	//     "osc52"    the terminal, which also works over ssh and in tmux
+	//     "register" only within the editor
+	//
+	// Whatever was copied last is also kept in a register, which is what
+	// is pasted when the host's clipboard can't be read.
+	clipboard struct {
+		t        *tbfe
+		lock     sync.Mutex
+		register string
+	}
+
+	// clipboardTool is a command line tool for copying to and pasting
+	// from the clipboard, which can be used when env is set.
+	clipboardTool struct {
+		env   string
+		copy  []string
+		paste []string
+	}
+)
+
+var clipboardTools = []clipboardTool{
+	{"WAYLAND_DISPLAY", []string{"wl-copy"}, []string{"wl-paste", "--no-newline"}},
+	{"DISPLAY", []string{"xclip", "-selection", "clipboard"}, []string{"xclip", "-selection", "clipboard", "-o"}},
+	{"DISPLAY", []string{"xsel", "--clipboard", "--input"}, []string{"xsel", "--clipboard", "--output"}},
+	{"", []string{"pbcopy"}, []string{"pbpaste"}},
+}
+
+// findClipboardTool returns the first clipboard tool that is installed
+// and usable in this environment, or nil.
+func findClipboardTool() *clipboardTool {
+	for i, ct := range clipboardTools {
+		if ct.env != "" && os.Getenv(ct.env) == "" {
+			continue
+		}
+		if _, err := exec.LookPath(ct.copy[0]); err == nil {
+			return &clipboardTools[i]
+		}
+	}
+	return nil
+}
+
+// osc52 returns the escape sequence setting the terminal's clipboard to
+// s. Inside tmux the sequence is passed through to the outer terminal.
+func osc52(s string, tmux bool) string {
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(s)) + "\a"
+	if tmux {
+		seq = "\x1bPtmux;" + strings.Replace(seq, "\x1b", "\x1b\x1b", -1) + "\x1b\\"
+	}
+	return seq
+}
+
+func (c *clipboard) provider() string {
+	p, _ := c.t.editor.Settings().Get("clipboard_provider", "auto").(string)
+	return p
+}
+
+// tool returns the clipboard tool to use, or nil.
+func (c *clipboard) tool() *clipboardTool {
+	switch c.provider() {
+	case "auto", "tool":
+		return findClipboardTool()
+	}
+	return nil
+}
+
+func (c *clipboard) set(s string) error {
+	c.lock.Lock()
+	c.register = s
+	c.lock.Unlock()
+
+	p := c.provider()
+	if ct := c.tool(); ct != nil {
+		cmd := exec.Command(ct.copy[0], ct.copy[1:]...)
+		cmd.Stdin = strings.NewReader(s)
+		err := cmd.Run()
+		if err == nil || p == "tool" {
+			return err
+		}
+		log.Warn("Failed to copy with %s: %s", ct.copy[0], err)
+	}
+	switch p {
+	case "auto", "osc52":
+		c.t.writeEscape(osc52(s, os.Getenv("TMUX") != ""))
+	case "tool", "register":
+	default:
+		log.Warn("Unknown clipboard_provider: %s", p)
+	}
+	return nil
+}
+
+func (c *clipboard) get() (string, error) {
+	if ct := c.tool(); ct != nil {
+		out, err := exec.Command(ct.paste[0], ct.paste[1:]...).Output()
+		if err == nil {
+			return string(out), nil
+		}
+		log.Warn("Failed to paste with %s: %s", ct.paste[0], err)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.register, nil
+}
+
+// writeEscape queues the escape sequence s to be written to the terminal
+// after the screen has been drawn, so it doesn't end up in the middle of
+// what termbox writes.
+func (t *tbfe) writeEscape(s string) {
+	t.lock.Lock()
+	t.escapes = append(t.escapes, s)
+	t.lock.Unlock()
+	t.render()
+}
+
+// flushEscapes writes out the escape sequences queued with writeEscape.
+func (t *tbfe) flushEscapes() {
+	t.lock.Lock()
+	es := t.escapes
+	t.escapes = nil
+	t.lock.Unlock()
+
+	for _, s := range es {
+		if err := scr.WriteRaw(s); err != nil {
+			log.Warn("Failed to write an escape sequence: %s", err)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import "testing"
+
+func TestOSC52(t *testing.T) {
+	tests := []struct {
+		s    string
+		tmux bool
+		exp  string
+	}{
+		{"lime", false, "\x1b]52;c;bGltZQ==\a"},
+		{"", false, "\x1b]52;c;\a"},
+		{"lime", true, "\x1bPtmux;\x1b\x1b]52;c;bGltZQ==\a\x1b\\"},
+	}
+
+	for i, test := range tests {
+		if s := osc52(test.s, test.tmux); s != test.exp {
+			t.Errorf("Test %d: Expected %q, but got %q", i, test.exp, s)
+		}
+	}
+}
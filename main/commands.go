@@ -0,0 +1,88 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/keys"
+	"github.com/limetext/backend/log"
+	"github.com/limetext/loaders"
+)
+
+var errNoFrontend = errors.New("termbox frontend is not running")
+
+// frontendKeymap binds keys to commands the Default package doesn't know
+// about, because only this frontend provides them.
+const frontendKeymap = `[
+	{ "keys": ["ctrl+q"], "command": "exit" }
+]`
+
+var frontendKeyBindings keys.HasKeyBindings
+
+// frontend returns the termbox frontend the editor is currently talking to,
+// or nil if the editor has another (or no) frontend.
+func frontend() *tbfe {
+	t, _ := backend.GetEditor().Frontend().(*tbfe)
+	return t
+}
+
+// intArg returns the integer value of the named command argument. Numbers
+// coming from json files are float64, so those are converted.
+func intArg(args backend.Args, name string, def int) int {
+	switch v := args[name].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return def
+}
+
+func register(cmds []backend.Command) {
+	ch := backend.GetEditor().CommandHandler()
+	for _, cmd := range cmds {
+		if err := ch.RegisterWithDefault(cmd); err != nil {
+			log.Warn("Failed to register command: %s", err)
+		}
+	}
+}
+
+// addKeyBindings puts the bindings of frontendKeymap below all of the
+// editor's, so that the Default package and the user can override them.
+func addKeyBindings(ed *backend.Editor) {
+	kb := ed.KeyBindings()
+	for p := kb.Parent(); p != nil; p = kb.Parent() {
+		if p == &frontendKeyBindings {
+			return
+		}
+		kb = p.KeyBindings()
+	}
+	kb.SetParent(&frontendKeyBindings)
+}
+
+func init() {
+	if err := loaders.LoadJSON([]byte(frontendKeymap), frontendKeyBindings.KeyBindings()); err != nil {
+		log.Error("Couldn't load the frontend's key bindings: %s", err)
+	}
+	// The input panel's keys aren't ones a keymap can name
+	kb := frontendKeyBindings.KeyBindings()
+	kb.Bindings = append(kb.Bindings, inputPanelBindings...)
+	sort.Sort(kb)
+	register([]backend.Command{
+		&SetLayoutCommand{},
+		&FocusGroupCommand{},
+		&NextViewCommand{},
+		&PrevViewCommand{},
+		&SelectByIndexCommand{},
+		&ShowOverlayCommand{},
+		&ShowPanelCommand{},
+		&HideInputPanelCommand{},
+		&ExitCommand{},
+		&MouseSelectCommand{},
+	})
+}
@@ -0,0 +1,275 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+
+	"github.com/limetext/backend"
+	. "github.com/limetext/text"
+	"github.com/limetext/util"
+	"github.com/nsf/termbox-go"
+)
+
+type (
+	// viewState is what drawing a view depends on besides its text,
+	// selection and syntax. The cells it was drawn with can only be
+	// reused while it stays the same.
+	viewState struct {
+		x, y, width, height int
+		scroll              int
+		tabSize             int
+		gutter              int
+		wrap                wrapConfig
+		caretStyle          termbox.Attribute
+		scheme              string
+		colors              int
+		fg, bg              termbox.Attribute
+	}
+
+	// cachedLine is a line of a view as it was drawn, at row y of the
+	// view and n rows high with skip rows scrolled off, and the hash of
+	// its part of the recipe. It has rows rows from skip on, which is
+	// more than n if it was cut off at the bottom of the view.
+	cachedLine struct {
+		y, n, skip int
+		rows       int
+		recipe     uint64
+	}
+
+	// viewCache holds the cells of a view as it was last rendered, so that
+	// the lines which haven't changed since can be copied back to the
+	// screen instead of being rendered again.
+	viewCache struct {
+		state      viewState
+		cells      []termbox.Cell
+		sel        []Region
+		highlights []Region
+		blink      bool
+
+		// The view is edited while it's rendered, so lock guards the
+		// fields below
+		lock  sync.Mutex
+		lines map[int]cachedLine
+		// The lines edited since the view was drawn, at change count
+		// changeCount, and the change count of the last edit
+		edits       damage
+		changeCount int
+		editCount   int
+		// Whether the syntax was parsed again since, which can change
+		// the colours of any line
+		recolor bool
+	}
+
+	// damage is the set of lines of a view that have to be rendered
+	// again.
+	damage struct {
+		// Ranges of lines, as regions of line numbers rather than text
+		// points
+		rows []Region
+		// Whether all lines are damaged
+		all bool
+	}
+)
+
+// viewCache returns the cache of v for drawing it in state s. The cache
+// is emptied if v was last drawn in another state.
+func (t *tbfe) viewCache(v *backend.View, s viewState) *viewCache {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	c, ok := t.caches[v]
+	if !ok || c.state != s {
+		c = &viewCache{state: s, lines: make(map[int]cachedLine)}
+		t.caches[v] = c
+	}
+	return c
+}
+
+// invalidate makes the next render of v draw all of it again.
+func (t *tbfe) invalidate(v *backend.View) {
+	t.lock.Lock()
+	delete(t.caches, v)
+	t.lock.Unlock()
+}
+
+// recolor makes the next render of v compare the colours of all of its
+// lines with the cache, because the syntax was parsed again.
+func (t *tbfe) recolor(v *backend.View) {
+	t.lock.Lock()
+	c, ok := t.caches[v]
+	t.lock.Unlock()
+	if ok {
+		c.lock.Lock()
+		c.recolor = true
+		c.lock.Unlock()
+	}
+}
+
+// edited records an edit of v, which has damaged lines row to end and
+// moved the lines after them by shift lines.
+func (t *tbfe) edited(v *backend.View, row, end, shift int) {
+	t.lock.Lock()
+	c, ok := t.caches[v]
+	t.lock.Unlock()
+	if ok {
+		c.edited(v.ChangeCount(), row, end, shift)
+	}
+}
+
+// edited damages lines row to end, including end, which were edited at
+// change count cc. The lines after row are moved down by shift lines,
+// or up if it's negative, and those moved onto row are dropped as they
+// were joined with it.
+func (c *viewCache) edited(cc, row, end, shift int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if shift != 0 {
+		lines := make(map[int]cachedLine, len(c.lines))
+		for r, l := range c.lines {
+			if r <= row {
+				lines[r] = l
+			} else if r+shift > row {
+				lines[r+shift] = l
+			}
+		}
+		c.lines = lines
+		for i, r := range c.edits.rows {
+			c.edits.rows[i] = Region{moveRow(r.Begin(), row, shift), moveRow(r.End()-1, row, shift) + 1}
+		}
+	}
+	c.edits.addRows(row, end)
+	c.editCount = cc
+}
+
+// moveRow returns where line r is after the lines after row were moved
+// by shift lines.
+func moveRow(r, row, shift int) int {
+	if r <= row {
+		return r
+	}
+	if r+shift < row {
+		return row
+	}
+	return r + shift
+}
+
+// damage returns the lines of v that have to be drawn again since c was
+// drawn: the lines edited since, and those where the selection, find
+// highlights or caret blink changed. All of them are damaged if v was
+// edited up to change count cc without c seeing it. It also returns the
+// lines in the cache, and whether their colours have to be compared with
+// the recipe.
+func (c *viewCache) damage(v *backend.View, cc int, sel, highlights []Region, blink bool) (d damage, lines map[int]cachedLine, recolor bool) {
+	c.lock.Lock()
+	d, c.edits = c.edits, damage{}
+	d.all = cc != c.changeCount && cc != c.editCount
+	lines, recolor = c.lines, c.recolor
+	c.recolor = false
+	c.lock.Unlock()
+
+	if !regionsEqual(sel, c.sel) {
+		d.addRegions(v, c.sel)
+		d.addRegions(v, sel)
+	}
+	if !regionsEqual(highlights, c.highlights) {
+		d.addRegions(v, c.highlights)
+		d.addRegions(v, highlights)
+	}
+	if blink != c.blink {
+		for _, r := range sel {
+			d.addRegions(v, []Region{{r.B, r.B}})
+		}
+	}
+	return
+}
+
+// save copies the cells of the view from the screen, along with the
+// lines drawn in them at change count cc.
+func (c *viewCache) save(lines map[int]cachedLine, cc int) {
+	c.lock.Lock()
+	// The lines edited while the view was drawn were moved in the lines
+	// it was drawn from, so which ones these are isn't known
+	if c.editCount > cc {
+		lines = make(map[int]cachedLine)
+	}
+	c.lines, c.changeCount = lines, cc
+	c.lock.Unlock()
+
+	s := c.state
+	buf := scr.CellBuffer()
+	sw, sh := scr.Size()
+	c.cells = make([]termbox.Cell, s.width*s.height)
+	if len(buf) < sw*sh {
+		return
+	}
+	for y := 0; y < s.height && s.y+y < sh; y++ {
+		for x := 0; x < s.width && s.x+x < sw; x++ {
+			c.cells[y*s.width+x] = buf[(s.y+y)*sw+s.x+x]
+		}
+	}
+}
+
+// restore draws the first n rows of the cells of the cached line l at
+// row y of the view.
+func (c *viewCache) restore(l cachedLine, y, n int) {
+	p := util.Prof.Enter("render.copy")
+	defer p.Exit()
+
+	s := c.state
+	for i := 0; i < n; i++ {
+		row := c.cells[(l.y+i)*s.width : (l.y+i+1)*s.width]
+		for x, cell := range row {
+			scr.SetCell(s.x+x, s.y+y+i, cell.Ch, cell.Fg, cell.Bg)
+		}
+	}
+}
+
+// addRows marks lines a to b, including b, as damaged.
+func (d *damage) addRows(a, b int) {
+	d.rows = append(d.rows, Region{a, b + 1})
+}
+
+// addRegions marks the lines of v that rs cover as damaged. Regions of
+// text that has since been erased are cut off at the end of the buffer.
+func (d *damage) addRegions(v *backend.View, rs []Region) {
+	size := v.Size()
+	for _, r := range rs {
+		a, b := r.Begin(), r.End()
+		if a > size {
+			a = size
+		}
+		if b > size {
+			b = size
+		}
+		ra, _ := v.RowCol(a)
+		rb, _ := v.RowCol(b)
+		d.addRows(ra, rb)
+	}
+}
+
+// has reports whether line row is damaged.
+func (d *damage) has(row int) bool {
+	if d.all {
+		return true
+	}
+	for _, r := range d.rows {
+		if row >= r.Begin() && row < r.End() {
+			return true
+		}
+	}
+	return false
+}
+
+func regionsEqual(a, b []Region) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
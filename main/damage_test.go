@@ -0,0 +1,175 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/limetext/backend"
+	. "github.com/limetext/text"
+)
+
+func TestDamage(t *testing.T) {
+	tests := []struct {
+		rows [][2]int
+		all  bool
+		exp  []bool
+	}{
+		{nil, false, []bool{false, false, false, false, false}},
+		{[][2]int{{1, 1}}, false, []bool{false, true, false, false, false}},
+		{[][2]int{{1, 2}, {4, 4}}, false, []bool{false, true, true, false, true}},
+		{nil, true, []bool{true, true, true, true, true}},
+	}
+
+	for i, test := range tests {
+		d := damage{all: test.all}
+		for _, r := range test.rows {
+			d.addRows(r[0], r[1])
+		}
+		for row, exp := range test.exp {
+			if has := d.has(row); has != exp {
+				t.Errorf("Test %d: Expected row %d to be damaged: %v, but got %v", i, row, exp, has)
+			}
+		}
+	}
+}
+
+func TestViewCacheEdited(t *testing.T) {
+	tests := []struct {
+		row, end, shift int
+		// The rows the cached lines 0 to 4 end up at, or -1 if they're
+		// dropped
+		moved   []int
+		damaged []bool
+	}{
+		// A line edited in place
+		{2, 2, 0, []int{0, 1, 2, 3, 4}, []bool{false, false, true, false, false, false}},
+		// Two lines inserted after line 1
+		{1, 3, 2, []int{0, 1, 4, 5, 6}, []bool{false, true, true, true, false, false, false}},
+		// Lines 2 and 3 joined with line 1
+		{1, 1, -2, []int{0, 1, -1, -1, 2}, []bool{false, true, false, false}},
+	}
+
+	for i, test := range tests {
+		c := &viewCache{lines: make(map[int]cachedLine)}
+		for row := 0; row < 5; row++ {
+			c.lines[row] = cachedLine{y: row}
+		}
+		// Line 3 was damaged before, and is moved along
+		c.edits.addRows(3, 3)
+		c.edited(1, test.row, test.end, test.shift)
+
+		for y, row := range test.moved {
+			l, ok := c.lines[row]
+			if row == -1 {
+				ok = false
+				for _, l := range c.lines {
+					ok = ok || l.y == y
+				}
+				if ok {
+					t.Errorf("Test %d: Expected line %d to be dropped", i, y)
+				}
+				continue
+			}
+			if !ok || l.y != y {
+				t.Errorf("Test %d: Expected line %d to be at row %d, but got %v", i, y, row, c.lines)
+			}
+		}
+		moved := moveRow(3, test.row, test.shift)
+		for row, exp := range test.damaged {
+			if row == moved {
+				exp = true
+			}
+			if has := c.edits.has(row); has != exp {
+				t.Errorf("Test %d: Expected row %d to be damaged: %v, but got %v", i, row, exp, has)
+			}
+		}
+		if c.editCount != 1 {
+			t.Errorf("Test %d: Expected the edit count to be 1, but got %d", i, c.editCount)
+		}
+	}
+}
+
+func TestRegionsEqual(t *testing.T) {
+	tests := []struct {
+		a, b []Region
+		exp  bool
+	}{
+		{nil, nil, true},
+		{nil, []Region{}, true},
+		{[]Region{{1, 2}}, []Region{{1, 2}}, true},
+		{[]Region{{1, 2}}, []Region{{2, 1}}, false},
+		{[]Region{{1, 2}}, []Region{{1, 2}, {3, 3}}, false},
+	}
+
+	for i, test := range tests {
+		if eq := regionsEqual(test.a, test.b); eq != test.exp {
+			t.Errorf("Test %d: Expected %v, but got %v", i, test.exp, eq)
+		}
+	}
+}
+
+func TestRenderEdited(t *testing.T) {
+	s := newMemScreen(20, 6)
+	old := scr
+	scr = s
+	defer func() { scr = old }()
+
+	ed := backend.GetEditor()
+	w := ed.NewWindow()
+	defer w.Close()
+	v := w.NewFile()
+	defer func() {
+		v.SetScratch(true)
+		v.Close()
+	}()
+	e := v.BeginEdit()
+	v.Insert(e, 0, "one\ntwo\nthree\nfour")
+	v.EndEdit(e)
+
+	fe := &tbfe{
+		layout:     make(map[*backend.View]layout),
+		highlights: make(map[*backend.View][]Region),
+		caches:     make(map[*backend.View]*viewCache),
+		editor:     ed,
+	}
+	fe.layout[v] = layout{width: 20, height: 6}
+	fe.Show(v, Region{})
+	v.AddObserver(&tbfeBufferDeltaObserver{t: fe, view: v})
+	fe.renderView(v, fe.layout[v])
+
+	tests := []struct {
+		edit func(e *backend.Edit)
+		// The number of lines rendered again
+		exp int
+	}{
+		{func(e *backend.Edit) { v.Insert(e, 4, "x") }, 1},
+		// The lines after a line break moved down, but not rendered
+		{func(e *backend.Edit) { v.Insert(e, 5, "\n") }, 2},
+		{func(e *backend.Edit) { v.Erase(e, Region{A: 5, B: 6}) }, 1},
+	}
+
+	for i, test := range tests {
+		e := v.BeginEdit()
+		test.edit(e)
+		v.EndEdit(e)
+
+		before := profile()
+		fe.renderView(v, fe.layout[v])
+		if n := profile()["render.line"].Calls - before["render.line"].Calls; n != test.exp {
+			t.Errorf("Test %d: Expected %d lines to be rendered, but got %d", i, test.exp, n)
+		}
+
+		// It's drawn the same as it is from scratch
+		cells := s.CellBuffer()
+		fe.invalidate(v)
+		s.Clear(defaultFg, defaultBg)
+		fe.renderView(v, fe.layout[v])
+		if exp := s.CellBuffer(); !reflect.DeepEqual(cells, exp) {
+			t.Errorf("Test %d: Expected the screen to be %v, but got %v", i, exp, cells)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/limetext/backend/keys"
+)
+
+// dialog is a modal message box with a row of buttons.
+type dialog struct {
+	t            *tbfe
+	lock         sync.Mutex
+	msg          string
+	buttons      []string
+	selected     int
+	cancelButton int
+	result       chan int
+}
+
+const dialogMaxWidth = 60
+
+// ask shows msg in a dialog with the given buttons and blocks until one
+// of them is chosen, returning its index. Escape picks the button at
+// index cancel. The answer comes in through the main loop, so this must
+// not be called from it.
+func (t *tbfe) ask(msg string, buttons []string, cancel int) int {
+	d := &dialog{
+		t:            t,
+		msg:          msg,
+		buttons:      buttons,
+		cancelButton: cancel,
+		result:       make(chan int, 1),
+	}
+	t.showOverlay(d)
+	return <-d.result
+}
+
+// MessageDialog shows msg and waits for the user to dismiss it.
+func (t *tbfe) MessageDialog(msg string) {
+	t.ask(msg, []string{"Ok"}, 0)
+}
+
+// OkCancelDialog shows msg and reports whether the user chose the ok
+// button, which is labelled with ok.
+func (t *tbfe) OkCancelDialog(msg, ok string) bool {
+	if ok == "" {
+		ok = "Ok"
+	}
+	return t.ask(msg, []string{ok, "Cancel"}, 1) == 0
+}
+
+func (d *dialog) done(i int) {
+	d.t.hideOverlay(d)
+	d.result <- i
+}
+
+func (d *dialog) cancel() {
+	d.done(d.cancelButton)
+}
+
+func (d *dialog) handleInput(kp keys.KeyPress) {
+	d.lock.Lock()
+	switch kp.Key {
+	case keys.Escape:
+		d.lock.Unlock()
+		d.done(d.cancelButton)
+		return
+	case keys.Enter:
+		d.lock.Unlock()
+		d.done(d.selected)
+		return
+	case keys.Left:
+		d.selected = (d.selected + len(d.buttons) - 1) % len(d.buttons)
+	case keys.Right, '\t':
+		d.selected = (d.selected + 1) % len(d.buttons)
+	}
+	d.lock.Unlock()
+	d.t.render()
+}
+
+// wrapText splits s into lines no longer than width, breaking at spaces
+// where possible.
+func wrapText(s string, width int) (lines []string) {
+	for _, para := range strings.Split(s, "\n") {
+		line := []rune{}
+		for _, word := range strings.Fields(para) {
+			w := []rune(word)
+			for len(w) > width {
+				if len(line) > 0 {
+					lines = append(lines, string(line))
+					line = line[:0]
+				}
+				lines = append(lines, string(w[:width]))
+				w = w[width:]
+			}
+			if len(line) > 0 && len(line)+1+len(w) > width {
+				lines = append(lines, string(line))
+				line = line[:0]
+			}
+			if len(line) > 0 {
+				line = append(line, ' ')
+			}
+			line = append(line, w...)
+		}
+		lines = append(lines, string(line))
+	}
+	return
+}
+
+func (d *dialog) render(w, h int) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	labels := make([][]rune, len(d.buttons))
+	bw := 0
+	for i, b := range d.buttons {
+		labels[i] = []rune("[ " + b + " ]")
+		bw += len(labels[i]) + 1
+	}
+
+	width := dialogMaxWidth
+	if width > w-4 {
+		width = w - 4
+	}
+	lines := wrapText(d.msg, width-4)
+	inner := bw
+	for _, l := range lines {
+		if n := len([]rune(l)); n > inner {
+			inner = n
+		}
+	}
+	width = inner + 4
+	height := len(lines) + 4
+	x, y := (w-width)/2, (h-height)/2
+
+	for j := y; j < y+height; j++ {
+		for i := x; i < x+width; i++ {
+			r := ' '
+			switch {
+			case i == x && j == y:
+				r = '┌'
+			case i == x+width-1 && j == y:
+				r = '┐'
+			case i == x && j == y+height-1:
+				r = '└'
+			case i == x+width-1 && j == y+height-1:
+				r = '┘'
+			case i == x || i == x+width-1:
+				r = '│'
+			case j == y || j == y+height-1:
+				r = '─'
+			}
+			scr.SetCell(i, j, r, defaultFg, overlayBg)
+		}
+	}
+	for i, l := range lines {
+		addString(x+2, y+1+i, l, defaultFg, overlayBg)
+	}
+
+	bx := x + width - 1 - bw
+	for i, l := range labels {
+		bg := overlayBg
+		if i == d.selected {
+			bg = selectionBg
+		}
+		addRunes(bx, y+height-2, l, defaultFg, bg)
+		bx += len(l) + 1
+	}
+}
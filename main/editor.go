@@ -3,17 +3,36 @@ package main
 import (
 	"github.com/limetext/backend"
 	"github.com/limetext/backend/log"
+	"github.com/limetext/backend/render"
 )
 
 func setSchemeSettings(ed *backend.Editor) {
+	// The default colours can collide in terminals with few colours too
+	defer fixContrast()
+
 	s := ed.GetColorScheme(ed.Settings().Get("color_scheme", "").(string))
 	if s == nil {
 		log.Error("No colour scheme to set defaults from")
 		return
 	}
 
-	defaultFg = color256(s.GlobalSettings().Foreground)
-	defaultBg = color256(s.GlobalSettings().Background)
+	gs := s.GlobalSettings()
+	defaultFg = colorAttr(gs.Foreground)
+	defaultBg = colorAttr(gs.Background)
+
+	if gs.Selection != (render.Colour{}) {
+		selectionBg = colorAttr(gs.Selection)
+		selectionBorderBg = selectionBg
+	}
+	if gs.SelectionBorder != (render.Colour{}) {
+		selectionBorderBg = colorAttr(gs.SelectionBorder)
+	}
+	if gs.FindHighlight != (render.Colour{}) {
+		findHighlightBg = colorAttr(gs.FindHighlight)
+	}
+	if gs.FindHighlightForeground != (render.Colour{}) {
+		findHighlightFg = colorAttr(gs.FindHighlightForeground)
+	}
 }
 
 func createNewView(filename string, window *backend.Window) *backend.View {
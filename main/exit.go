@@ -0,0 +1,85 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/log"
+)
+
+// ExitCommand quits the editor, asking what to do about every view with
+// unsaved changes first.
+type ExitCommand struct {
+	backend.DefaultCommand
+}
+
+const (
+	exitSave = iota
+	exitDiscard
+	exitCancel
+)
+
+// dirtyViews returns the views of all windows that have unsaved changes.
+func dirtyViews(ed *backend.Editor) (vs []*backend.View) {
+	for _, w := range ed.Windows() {
+		for _, v := range w.Views() {
+			if v.IsDirty() {
+				vs = append(vs, v)
+			}
+		}
+	}
+	return
+}
+
+// saveView saves v, asking for a file name if it doesn't have one yet,
+// and reports whether it was saved.
+func (t *tbfe) saveView(v *backend.View) bool {
+	var err error
+	if v.FileName() != "" {
+		err = v.Save()
+	} else {
+		files := t.Prompt("Save As", "", backend.PROMPT_SAVE_AS)
+		if len(files) == 0 {
+			return false
+		}
+		err = v.SaveAs(files[0])
+	}
+	if err != nil {
+		log.Error("Failed to save %s: %s", viewName(v), err)
+		t.ErrorMessage(err.Error())
+		return false
+	}
+	return true
+}
+
+// exit asks whether to save, discard or keep each view with unsaved
+// changes, and shuts down unless the user cancels or a save fails. Like
+// ask, this must not be called from the main loop.
+func (t *tbfe) exit() {
+	for _, v := range dirtyViews(t.editor) {
+		t.activateView(v)
+		msg := fmt.Sprintf("Do you want to save the changes you made to %s?", viewName(v))
+		switch t.ask(msg, []string{"Save", "Don't Save", "Cancel"}, exitCancel) {
+		case exitSave:
+			if !t.saveView(v) {
+				return
+			}
+		case exitCancel:
+			return
+		}
+	}
+	t.shutdown <- true
+}
+
+func (c *ExitCommand) Run() error {
+	t := frontend()
+	if t == nil {
+		return errNoFrontend
+	}
+	t.exit()
+	return nil
+}
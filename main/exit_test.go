@@ -0,0 +1,48 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/keys"
+)
+
+func TestExitBinding(t *testing.T) {
+	ed := backend.GetEditor()
+	addKeyBindings(ed)
+	// Adding them again must not make the bindings their own parent
+	addKeyBindings(ed)
+
+	// The frontend's bindings are the editor's last parent
+	bs := ed.KeyBindings().Filter(keys.KeyPress{Key: 'q', Ctrl: true})
+	kb := &bs
+	for kb.Parent() != nil {
+		kb = kb.Parent().KeyBindings()
+	}
+	if len(kb.Bindings) != 1 || kb.Bindings[0].Command != "exit" {
+		t.Errorf("Expected ctrl+q to be bound to exit, but got %v", kb.Bindings)
+	}
+}
+
+func TestExitCommand(t *testing.T) {
+	fe := &tbfe{editor: backend.GetEditor(), shutdown: make(chan bool, 1)}
+	ed := backend.GetEditor()
+	old := ed.Frontend()
+	ed.SetFrontend(fe)
+	defer ed.SetFrontend(old)
+
+	// If the backend had a command called exit as well, ours wouldn't
+	// have been registered and this wouldn't reach the frontend.
+	if err := ed.CommandHandler().RunApplicationCommand("exit", nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-fe.shutdown:
+	default:
+		t.Error("Expected exit to shut the frontend down")
+	}
+}
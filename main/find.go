@@ -0,0 +1,371 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/keys"
+	"github.com/limetext/backend/log"
+	. "github.com/limetext/text"
+)
+
+type (
+	// findPanel is a docked overlay for incrementally searching the
+	// current view and replacing the matches.
+	findPanel struct {
+		t           *tbfe
+		lock        sync.Mutex
+		view        *backend.View
+		fields      [2][]rune
+		field       int
+		regex       bool
+		caseSens    bool
+		wholeWord   bool
+		re          *regexp.Regexp
+		err         error
+		matches     []findMatch
+		replaceMode bool
+	}
+
+	// findMatch is a match of the find panel's pattern. submatches holds
+	// the byte offsets of the match and its groups within the buffer
+	// text, for expanding the replacement.
+	findMatch struct {
+		region     Region
+		submatches []int
+	}
+
+	ShowPanelCommand struct {
+		backend.DefaultCommand
+		Panel string
+	}
+)
+
+const (
+	findField = iota
+	replaceField
+)
+
+// findPattern builds the regular expression searched for by the find
+// panel from what was typed and the state of its toggles.
+func findPattern(pattern string, regex, caseSens, wholeWord bool) (*regexp.Regexp, error) {
+	if !regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if wholeWord {
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	if !caseSens {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// findAll returns the non-empty matches of re in s, with regions in rune
+// offsets like the rest of the buffer API.
+func findAll(re *regexp.Regexp, s string) (ms []findMatch) {
+	runes, last := 0, 0
+	for _, sm := range re.FindAllStringSubmatchIndex(s, -1) {
+		if sm[0] == sm[1] {
+			continue
+		}
+		runes += utf8.RuneCountInString(s[last:sm[0]])
+		a := runes
+		runes += utf8.RuneCountInString(s[sm[0]:sm[1]])
+		last = sm[1]
+		ms = append(ms, findMatch{Region{a, runes}, sm})
+	}
+	return
+}
+
+// showFindPanel opens the find panel on the current view, starting out
+// with the text of the last selection if it is on a single line.
+func (t *tbfe) showFindPanel(replace bool) {
+	t.lock.Lock()
+	v := t.currentView
+	t.lock.Unlock()
+	if v == nil {
+		return
+	}
+
+	fp := &findPanel{t: t, view: v, replaceMode: replace}
+	if rs := v.Sel().Regions(); len(rs) > 0 {
+		if r := rs[len(rs)-1]; !r.Empty() && len(v.Lines(r)) == 1 {
+			fp.fields[findField] = []rune(v.Substr(r))
+		}
+	}
+	fp.search()
+	t.showOverlay(fp)
+}
+
+// search updates the matches after the pattern or the buffer changed.
+// Must be called with fp.lock held.
+func (fp *findPanel) search() {
+	fp.matches, fp.re, fp.err = nil, nil, nil
+	if len(fp.fields[findField]) > 0 {
+		fp.re, fp.err = findPattern(string(fp.fields[findField]), fp.regex, fp.caseSens, fp.wholeWord)
+		if fp.err == nil {
+			fp.matches = findAll(fp.re, fp.view.Substr(Region{0, fp.view.Size()}))
+		}
+	}
+
+	rs := make([]Region, len(fp.matches))
+	for i, m := range fp.matches {
+		rs[i] = m.region
+	}
+	fp.t.lock.Lock()
+	fp.t.highlights[fp.view] = rs
+	fp.t.lock.Unlock()
+}
+
+// next returns the index of the first match after the last selection, or
+// before the first one if reverse is set, wrapping around the buffer.
+// Must be called with fp.lock held.
+func (fp *findPanel) next(reverse bool) int {
+	if len(fp.matches) == 0 {
+		return -1
+	}
+	rs := fp.view.Sel().Regions()
+	if reverse {
+		p := 0
+		if len(rs) > 0 {
+			p = rs[0].Begin()
+		}
+		for i := len(fp.matches) - 1; i >= 0; i-- {
+			if fp.matches[i].region.End() <= p {
+				return i
+			}
+		}
+		return len(fp.matches) - 1
+	}
+	p := 0
+	if len(rs) > 0 {
+		p = rs[len(rs)-1].End()
+	}
+	for i, m := range fp.matches {
+		if m.region.Begin() >= p {
+			return i
+		}
+	}
+	return 0
+}
+
+// selectMatch selects match i and scrolls the view to it.
+// Must be called with fp.lock held.
+func (fp *findPanel) selectMatch(i int) {
+	if i < 0 {
+		return
+	}
+	r := fp.matches[i].region
+	fp.view.Sel().Clear()
+	fp.view.Sel().Add(r)
+	fp.t.Show(fp.view, r)
+}
+
+// current returns the index of the match that is selected, or -1.
+// Must be called with fp.lock held.
+func (fp *findPanel) current() int {
+	rs := fp.view.Sel().Regions()
+	if len(rs) != 1 {
+		return -1
+	}
+	for i, m := range fp.matches {
+		if m.region == rs[0] || (m.region.A == rs[0].B && m.region.B == rs[0].A) {
+			return i
+		}
+	}
+	return -1
+}
+
+// replacement returns what match m is replaced with. In regex mode the
+// replacement can refer to groups of the match, e.g. $1.
+// Must be called with fp.lock held.
+func (fp *findPanel) replacement(text string, m findMatch) string {
+	repl := string(fp.fields[replaceField])
+	if !fp.regex {
+		return repl
+	}
+	return string(fp.re.ExpandString(nil, repl, text, m.submatches))
+}
+
+// replace replaces the selected match, or all of them if all is set, and
+// moves on to the next match.
+// Must be called with fp.lock held.
+func (fp *findPanel) replace(all bool) {
+	ms := fp.matches
+	if !all {
+		i := fp.current()
+		if i < 0 {
+			fp.selectMatch(fp.next(false))
+			return
+		}
+		ms = ms[i : i+1]
+	}
+	if len(ms) == 0 {
+		return
+	}
+
+	text := fp.view.Substr(Region{0, fp.view.Size()})
+	e := fp.view.BeginEdit()
+	// Going backwards keeps the regions of earlier matches valid
+	for i := len(ms) - 1; i >= 0; i-- {
+		fp.view.Replace(e, ms[i].region, fp.replacement(text, ms[i]))
+	}
+	fp.view.EndEdit(e)
+
+	fp.search()
+	if all {
+		fp.t.StatusMessage(fmt.Sprintf("Replaced %d occurrences", len(ms)))
+	} else {
+		fp.selectMatch(fp.next(false))
+	}
+}
+
+func (fp *findPanel) handleInput(kp keys.KeyPress) {
+	fp.lock.Lock()
+	defer fp.t.render()
+	defer fp.lock.Unlock()
+
+	f := &fp.fields[fp.field]
+	toggle := (kp.Ctrl || kp.Alt) && !kp.Shift
+	switch {
+	case kp.Key == keys.Escape:
+		fp.close()
+	case kp.Key == '\t' && fp.replaceMode:
+		fp.field = 1 - fp.field
+	case kp.Key == keys.Enter && fp.field == replaceField:
+		fp.replace(kp.Ctrl || kp.Alt)
+	case kp.Key == keys.Enter:
+		fp.selectMatch(fp.next(kp.Shift))
+	case toggle && kp.Key == 'r':
+		fp.regex = !fp.regex
+		fp.search()
+	case toggle && kp.Key == 'c':
+		fp.caseSens = !fp.caseSens
+		fp.search()
+	case toggle && kp.Key == 'w':
+		fp.wholeWord = !fp.wholeWord
+		fp.search()
+	case toggle && kp.Key == 'a' && fp.replaceMode:
+		fp.replace(true)
+	case kp.Key == keys.Backspace:
+		if len(*f) > 0 {
+			*f = (*f)[:len(*f)-1]
+			fp.changed()
+		}
+	case isText(kp):
+		*f = append(*f, []rune(kp.Text)...)
+		fp.changed()
+	}
+}
+
+// changed searches again after a field was edited, jumping to the first
+// match from the caret while typing the pattern.
+// Must be called with fp.lock held.
+func (fp *findPanel) changed() {
+	if fp.field != findField {
+		return
+	}
+	fp.search()
+	if len(fp.matches) == 0 {
+		return
+	}
+	rs := fp.view.Sel().Regions()
+	p := 0
+	if len(rs) > 0 {
+		p = rs[len(rs)-1].Begin()
+	}
+	for i, m := range fp.matches {
+		if m.region.Begin() >= p {
+			fp.selectMatch(i)
+			return
+		}
+	}
+	fp.selectMatch(0)
+}
+
+// close hides the panel and its highlights.
+// Must be called with fp.lock held.
+func (fp *findPanel) close() {
+	fp.t.lock.Lock()
+	delete(fp.t.highlights, fp.view)
+	fp.t.lock.Unlock()
+	fp.t.hideOverlay(fp)
+}
+
+func (fp *findPanel) cancel() {
+	fp.close()
+}
+
+func (fp *findPanel) height() int {
+	if fp.replaceMode {
+		return 2
+	}
+	return 1
+}
+
+func (fp *findPanel) render(w, h int) {
+	fp.lock.Lock()
+	defer fp.lock.Unlock()
+
+	y := h - statusbarHeight - fp.height()
+	toggle := func(x int, label string, on bool) int {
+		bg := overlayBg
+		if on {
+			bg = selectionBg
+		}
+		x = addString(x, y, label, defaultFg, bg)
+		return x + 1
+	}
+	for row := y; row < y+fp.height(); row++ {
+		for x := 0; x < w; x++ {
+			scr.SetCell(x, row, ' ', defaultFg, overlayBg)
+		}
+	}
+
+	x := toggle(0, ".*", fp.regex)
+	x = toggle(x, "Aa", fp.caseSens)
+	x = toggle(x, `""`, fp.wholeWord)
+
+	labels := []string{"Find: ", "Replace: "}
+	cx, cy := 0, y
+	for i := 0; i < fp.height(); i++ {
+		lx := addString(x, y+i, labels[i], defaultFg, overlayBg)
+		lx = addString(lx, y+i, string(fp.fields[i]), defaultFg, overlayBg)
+		if i == fp.field {
+			cx, cy = lx, y+i
+		}
+	}
+	scr.SetCursor(cx, cy)
+
+	var status string
+	if fp.err != nil {
+		status = fp.err.Error()
+	} else if len(fp.fields[findField]) > 0 {
+		status = fmt.Sprintf("%d matches", len(fp.matches))
+	}
+	addString(w-1-len(status), y, status, defaultFg, overlayBg)
+}
+
+func (c *ShowPanelCommand) Run(w *backend.Window) error {
+	t := frontend()
+	if t == nil {
+		return errNoFrontend
+	}
+	switch c.Panel {
+	case "find", "incremental_find":
+		t.showFindPanel(false)
+	case "replace":
+		t.showFindPanel(true)
+	default:
+		log.Warn("Unsupported panel: %s", c.Panel)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	. "github.com/limetext/text"
+)
+
+func TestFindAll(t *testing.T) {
+	text := "Foo föo foo.bar foobar"
+	tests := []struct {
+		pattern                    string
+		regex, caseSens, wholeWord bool
+		exp                        []Region
+	}{
+		{"foo", false, false, false, []Region{{0, 3}, {8, 11}, {16, 19}}},
+		{"foo", false, true, false, []Region{{8, 11}, {16, 19}}},
+		{"foo", false, false, true, []Region{{0, 3}, {8, 11}}},
+		{"f.o", false, false, false, nil},
+		{"f.o", true, false, false, []Region{{0, 3}, {4, 7}, {8, 11}, {16, 19}}},
+		{"o.b", false, false, false, []Region{{10, 13}}},
+	}
+
+	for i, test := range tests {
+		re, err := findPattern(test.pattern, test.regex, test.caseSens, test.wholeWord)
+		if err != nil {
+			t.Fatalf("Test %d: %s", i, err)
+		}
+		ms := findAll(re, text)
+		if len(ms) != len(test.exp) {
+			t.Errorf("Test %d: Expected %d matches, got %d", i, len(test.exp), len(ms))
+			continue
+		}
+		for j, m := range ms {
+			if m.region != test.exp[j] {
+				t.Errorf("Test %d: Expected match %d to be %v, got %v", i, j, test.exp[j], m.region)
+			}
+		}
+	}
+}
@@ -4,13 +4,15 @@ import (
 	"flag"
 	"fmt"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/limetext/backend"
 	"github.com/limetext/backend/keys"
 	"github.com/limetext/backend/log"
-	"github.com/limetext/backend/render"
 	. "github.com/limetext/text"
 	"github.com/limetext/util"
 	"github.com/nsf/termbox-go"
@@ -28,13 +30,68 @@ type (
 		console        *backend.View
 		currentView    *backend.View
 		currentWindow  *backend.Window
+		groups         []*group
+		activeGroup    int
+		winLayout      windowLayout
+		overlay        overlay
+		inputPanel     *inputPanel
+		highlights     map[*backend.View][]Region
+		caches         map[*backend.View]*viewCache
+		mouse          mouseState
+		clipboard      clipboard
+		// Whether the screen was resized since it was last drawn
+		resized bool
+		// Escape sequences to write after the screen is drawn
+		escapes []string
 	}
 
 	layout struct {
 		x, y          int
 		width, height int
 		visible       Region
-		lastUpdate    int
+		// The column drawn at the left edge of the text when the view
+		// isn't word wrapped.
+		scroll     int
+		lastUpdate int
+		// Whether the selection changed since the view was last
+		// rendered, and the visible region should follow it.
+		follow bool
+	}
+
+	// lineRenderer draws the lines of a view, holding what's shared
+	// between them.
+	lineRenderer struct {
+		v     *backend.View
+		state viewState
+		// The left edge of the view and the line numbers, of the text,
+		// of the lines when scrolled horizontally, and the right edge
+		sx, tx, lx, ex int
+		sy             int
+		tabSize        int
+		lineNumbers    bool
+		numberSize     int
+		wc             wrapConfig
+		wrap           bool
+		caretStyle     termbox.Attribute
+		rc             *recipeCursor
+		fonts          *fontStyles
+		styles         map[string]termbox.Attribute
+		sc, hc         *selectionCursor
+	}
+
+	// viewLine is line row of a view, drawn at row y of it and n rows
+	// high, with its first skip rows scrolled off the top and total rows
+	// from there on. Lines copied from the cache aren't rendered, and
+	// their text isn't read.
+	viewLine struct {
+		row, y, n int
+		skip      int
+		total     int
+		region    Region
+		text      string
+		rows      []wrapRow
+		recipe    uint64
+		cached    bool
 	}
 
 	tbfeBufferDeltaObserver struct {
@@ -57,6 +114,10 @@ func createFrontend() *tbfe {
 	t.dorender = make(chan bool, render_chan_len)
 	t.shutdown = make(chan bool, 2)
 	t.layout = make(map[*backend.View]layout)
+	t.highlights = make(map[*backend.View][]Region)
+	t.caches = make(map[*backend.View]*viewCache)
+	t.groups = []*group{{}}
+	t.winLayout = singleLayout
 
 	t.editor = t.setupEditor()
 	t.console = t.editor.Console()
@@ -65,19 +126,21 @@ func createFrontend() *tbfe {
 	// Assuming that all extra arguments are files
 	if files := flag.Args(); len(files) > 0 {
 		for _, file := range files {
-			t.currentView = createNewView(file, t.currentWindow)
+			t.addView(createNewView(file, t.currentWindow))
 		}
 	} else {
-		t.currentView = t.currentWindow.NewFile()
+		t.addView(t.currentWindow.NewFile())
 	}
 
 	t.editor.AddPackagesPath("../packages")
 
 	t.editor.SetFrontend(&t)
+	t.clipboard.t = &t
+	t.editor.SetClipboardFuncs(t.clipboard.set, t.clipboard.get)
 	t.editor.LogInput(false)
 	t.editor.LogCommands(false)
 
-	w, h := termbox.Size()
+	w, h := scr.Size()
 	t.handleResize(h, w, true)
 
 	t.console.AddObserver(&t)
@@ -93,117 +156,357 @@ func (t *tbfe) renderView(v *backend.View, lay layout) {
 	p := util.Prof.Enter("render")
 	defer p.Exit()
 
-	sx, sy, w, h := lay.x, lay.y, lay.width, lay.height
-	vr := lay.visible
-	runes := v.Substr(vr)
-	x, y := sx, sy
-	ex, ey := sx+w, sy+h
+	lr := newLineRenderer(t.editor, v, lay)
+	sel := v.Sel().Regions()
+	t.lock.Lock()
+	highlights := t.highlights[v]
+	t.lock.Unlock()
+	lr.sc = newSelectionCursor(sel)
+	lr.hc = newSelectionCursor(highlights)
+
+	c := t.viewCache(v, lr.state)
+	cc := v.ChangeCount()
+	d, cache, recolor := c.damage(v, cc, sel, highlights, blink)
+
+	// Lay out the visible lines. The text of lines that are cached and
+	// undamaged isn't needed, as they're copied from the cache with the
+	// rows they had, unless it's the first and can be scrolled to
+	// another of its rows.
+	first, _ := v.RowCol(lay.visible.Begin())
+	last, _ := v.RowCol(v.Size())
+	var lines []viewLine
+	y := 0
+	for row := first; row <= last && y < lay.height; row++ {
+		l := viewLine{row: row, y: y, region: v.Line(v.TextPoint(row, 0))}
+		cl, ok := cache[row]
+		l.cached = ok && !d.has(row)
+		if l.cached && cl.skip == 0 && !(lr.wrap && row == first) {
+			l.total = cl.rows
+		} else {
+			lr.layoutLine(&l, lay.visible.Begin(), row == first)
+			l.cached = l.cached && cl.skip == l.skip
+		}
+		l.n = l.total
+		if l.n > lay.height-y {
+			l.n = lay.height - y
+		}
+		l.cached = l.cached && cl.n >= l.n
+		lines = append(lines, l)
+		y += l.n
+	}
+
+	// The lines that aren't cached are rendered with the recipe of the
+	// runs of them. When the syntax was parsed again, the colours of any
+	// line can have changed, so the recipe of all of them is compared
+	// with the cache instead.
+	for i := 0; i < len(lines); {
+		if lines[i].cached && !recolor {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(lines) && (recolor || !lines[j].cached) {
+			j++
+		}
+		lr.rc = lr.transcribe(lines[i].region.Cover(lines[j-1].region))
+		for ; i < j; i++ {
+			l := &lines[i]
+			l.recipe = lr.rc.hash(lr.withBreak(l.region))
+			if l.cached && cache[l.row].recipe == l.recipe {
+				continue
+			}
+			if l.cached {
+				l.cached = false
+				lr.layoutLine(l, lay.visible.Begin(), l.row == first)
+			}
+			lr.clearRows(l.y, l.n)
+			lr.renderLine(*l)
+		}
+	}
+
+	saved := make(map[int]cachedLine, len(lines))
+	for _, l := range lines {
+		if l.cached {
+			l.recipe = cache[l.row].recipe
+			c.restore(cache[l.row], l.y, l.n)
+			// Lines moved by edits above them are numbered anew
+			if lr.lineNumbers && l.skip == 0 {
+				renderLineNumber(lr.sx, lr.sy+l.y, l.row+1, lr.numberSize, defaultFg, defaultBg)
+			}
+		}
+		saved[l.row] = cachedLine{l.y, l.n, l.skip, l.total, l.recipe}
+	}
+	// The rows past the end of the buffer are left blank
+	lr.clearRows(y, lay.height-y)
+	c.save(saved, cc)
+	c.sel, c.highlights, c.blink = sel, highlights, blink
+
+	// Only follow the caret when the selection has changed, so that the
+	// view can be scrolled away from it with the mouse wheel.
+	if len(sel) > 0 && lay.follow {
+		t.lock.Lock()
+		if l, ok := t.layout[v]; ok {
+			l.follow = false
+			t.layout[v] = l
+		}
+		t.lock.Unlock()
+		r := sel[len(sel)-1]
+		if !lay.visible.Covers(r) || !lr.wrap && lay.scroll != hscroll(v, lay) {
+			t.Show(v, r)
+		}
+	}
+}
+
+// layoutLine reads the text of l and works out its rows. The first line
+// of the view is scrolled to the row of start when it's word wrapped.
+func (lr *lineRenderer) layoutLine(l *viewLine, start int, first bool) {
+	l.text = lr.v.Substr(l.region)
+	l.total = 1
+	if lr.wrap {
+		l.rows = lr.wc.rows([]rune(l.text))
+		if first {
+			l.skip = rowAt(l.rows, start-l.region.Begin())
+		}
+		l.total = len(l.rows) - l.skip
+	}
+}
+
+// withBreak returns r with the line break after it, which is drawn too.
+func (lr *lineRenderer) withBreak(r Region) Region {
+	if r.B < lr.v.Size() {
+		r.B++
+	}
+	return r
+}
+
+// transcribe returns a cursor over the recipe of the lines in span.
+func (lr *lineRenderer) transcribe(span Region) *recipeCursor {
+	rc := newRecipeCursor(lr.v.Transform(lr.withBreak(span)).Transcribe())
+	if lr.fonts != nil {
+		rc.style = lr.fontStyle
+	}
+	return rc
+}
+
+// clearRows blanks n rows of the view from row y on, which the screen
+// isn't cleared under.
+func (lr *lineRenderer) clearRows(y, n int) {
+	s := lr.state
+	for j := y; j < y+n; j++ {
+		for x := s.x; x < s.x+s.width; x++ {
+			scr.SetCell(x, s.y+j, ' ', defaultFg, defaultBg)
+		}
+	}
+}
+
+// newLineRenderer returns a renderer for the lines of v laid out as lay.
+// Its selection cursors are left for the caller to set.
+func newLineRenderer(ed *backend.Editor, v *backend.View, lay layout) *lineRenderer {
+	lr := &lineRenderer{v: v, sx: lay.x, sy: lay.y, ex: lay.x + lay.width}
 
 	style, _ := v.Settings().Get("caret_style", "underline").(string)
 	inverse, _ := v.Settings().Get("inverse_caret_state", false).(bool)
-	caretStyle := getCaretStyle(style, inverse)
-	oldCaretStyle := caretStyle
+	lr.caretStyle = getCaretStyle(style, inverse)
+	caretStyle := lr.caretStyle
 	caretBlink, _ := v.Settings().Get("caret_blink", true).(bool)
 	if caretBlink && blink {
-		caretStyle = 0
+		lr.caretStyle = 0
 	}
 
-	tabSize := 4
-	if i, ok := v.Settings().Get("tab_size", tabSize).(int); ok {
-		tabSize = i
-	}
-
-	recipe := v.Transform(vr).Transcribe()
-	fg, bg := defaultFg, defaultBg
+	lr.tabSize = viewTabSize(v)
 
-	sel := v.Sel()
+	// The recipe only has colours, so the font style of the scope of
+	// each span is looked up separately if the scheme has font styles
+	scheme, _ := v.Settings().Get("color_scheme", "").(string)
+	if scheme != "" {
+		lr.fonts = loadFontStyles(scheme)
+	}
+	lr.styles = make(map[string]termbox.Attribute)
 
-	lineNumbers, _ := v.Settings().Get("line_numbers", true).(bool)
+	lr.lineNumbers, _ = v.Settings().Get("line_numbers", true).(bool)
 	eofline, _ := v.RowCol(v.Size())
-	lineNumberRenderSize := len(intToRunes(eofline))
-	line, _ := v.RowCol(vr.Begin())
-	line += 1
+	lr.numberSize = len(intToRunes(eofline + 1))
+	gutter := gutterWidth(v)
+	lr.tx = lay.x + gutter
+
+	// Lines start further left when scrolled horizontally
+	lr.wc, lr.wrap = viewWrap(v, lay)
+	scroll := lay.scroll
+	if lr.wrap {
+		scroll = 0
+	} else {
+		lr.wc = wrapConfig{}
+	}
+	lr.lx = lr.tx - scroll
+
+	lr.state = viewState{
+		x: lay.x, y: lay.y, width: lay.width, height: lay.height,
+		scroll:     scroll,
+		tabSize:    lr.tabSize,
+		gutter:     gutter,
+		wrap:       lr.wc,
+		caretStyle: caretStyle,
+		scheme:     scheme,
+		colors:     colors,
+		fg:         defaultFg,
+		bg:         defaultBg,
+	}
+	return lr
+}
 
-	for i, r := range runes {
-		fg, bg = defaultFg, defaultBg
+// renderLine draws line l of the view.
+func (lr *lineRenderer) renderLine(l viewLine) {
+	p := util.Prof.Enter("render.line")
+	defer p.Exit()
 
-		if lineNumbers {
-			renderLineNumber(&line, &x, y, lineNumberRenderSize, fg, bg)
-		}
+	x, y := lr.lx, lr.sy+l.y
+	if lr.lineNumbers && l.skip == 0 {
+		renderLineNumber(lr.sx, y, l.row+1, lr.numberSize, defaultFg, defaultBg)
+	}
 
-		curr := 0
-		o := vr.Begin() + i
+	// Whether the line goes on past the left or right edge
+	clipLeft, clipRight := false, false
+	nextRow := 1
 
-		for curr < len(recipe) && (o >= recipe[curr].Region.Begin()) {
-			if o < recipe[curr].Region.End() {
-				fg = color256(render.Colour(recipe[curr].Flavour.Foreground))
-				bg = color256(render.Colour(recipe[curr].Flavour.Background))
+	rs := []rune(l.text)
+	i := 0
+	if l.skip > 0 {
+		i, x = l.rows[l.skip].start, lr.lx+l.rows[l.skip].col
+		nextRow = l.skip + 1
+	}
+	for ; i < len(rs); i++ {
+		r := rs[i]
+		if nextRow < len(l.rows) && i == l.rows[nextRow].start {
+			if nextRow >= l.skip+l.n {
+				return
 			}
-			curr++
+			y++
+			x = lr.lx + l.rows[nextRow].col
+			nextRow++
 		}
 
-		iscursor := sel.Contains(Region{o, o})
-		if iscursor {
-			fg = fg | caretStyle
-		}
+		fg, bg := lr.colours(l.region.Begin() + i)
 
 		if r == '\t' {
-			add := (x + 1 + (tabSize - 1)) &^ (tabSize - 1)
+			add := lr.lx + tabStop(x-lr.lx, lr.tabSize)
 			for ; x < add; x++ {
-				if x < ex {
-					termbox.SetCell(x, y, ' ', fg, bg)
+				if x < lr.tx {
+					clipLeft = true
+				} else if x >= lr.ex {
+					clipRight = true
+				} else {
+					scr.SetCell(x, y, ' ', fg, bg)
 				}
 				// A long cursor looks weird
 				fg = fg & ^(termbox.AttrUnderline | termbox.AttrReverse)
 			}
 			continue
 		}
-		if r == '\n' {
-			termbox.SetCell(x, y, ' ', fg, bg)
-			x = sx
-			y++
-			if lineNumbers {
-				// This results in additional calls to renderLineNumber.
-				// Maybe just accumulate positions needing line numbers, rendering them
-				// after the loop?
-				renderLineNumber(&line, &x, y, lineNumberRenderSize, defaultFg, defaultBg)
-			}
-			if y > ey {
-				break
-			}
+		w := runeWidth(r)
+		if w == 0 {
 			continue
 		}
-		termbox.SetCell(x, y, r, fg, bg)
-		x++
+		// Combining marks are drawn in the cell of the rune they follow,
+		// which shows the caret or selection on them too
+		r, n := cluster(rs, i)
+		for j := 1; j < n; j++ {
+			fg, bg = lr.markColours(l.region.Begin()+i+j, fg, bg)
+		}
+		i += n - 1
+		if x < lr.tx {
+			clipLeft = true
+		} else if x+w > lr.ex {
+			clipRight = true
+		} else {
+			scr.SetCell(x, y, r, fg, bg)
+		}
+		x += w
+	}
+
+	// The line break is drawn as a space, and the end of the buffer only
+	// if the caret is there
+	o := l.region.End()
+	fg, bg := defaultFg, defaultBg
+	draw := true
+	if o < lr.v.Size() {
+		fg, bg = lr.colours(o)
+	} else if draw = lr.sc.caret(o); draw {
+		fg = fg | lr.caretStyle
+	}
+	if draw && x >= lr.tx && x < lr.ex {
+		scr.SetCell(x, y, ' ', fg, bg)
 	}
-	fg, bg = defaultFg, defaultBg
-	// Need this if the cursor is at the end of the buffer
-	o := vr.Begin() + len(runes)
-	iscursor := sel.Contains(Region{o, o})
-	if iscursor {
-		fg = fg | caretStyle
-		termbox.SetCell(x, y, ' ', fg, bg)
+	if !lr.wrap {
+		renderClipMarks(y, lr.tx, lr.ex, clipLeft, clipRight)
 	}
+}
 
-	// restore original caretStyle before blink modification
-	caretStyle = oldCaretStyle
+// fontStyle returns the attributes of the font style of the scope at
+// offset o of the view.
+func (lr *lineRenderer) fontStyle(o int) termbox.Attribute {
+	scope := lr.v.ScopeName(o)
+	style, ok := lr.styles[scope]
+	if !ok {
+		style = fontStyleAttr(lr.fonts.style(scope))
+		lr.styles[scope] = style
+	}
+	return style
+}
 
-	if rs := sel.Regions(); len(rs) > 0 {
-		if r := rs[len(rs)-1]; !vr.Covers(r) {
-			t.Show(v, r)
-		}
+// markColours adds the caret and selection at offset o, which is a
+// combining mark, to the colours fg and bg of the cell it's drawn in.
+func (lr *lineRenderer) markColours(o int, fg, bg termbox.Attribute) (termbox.Attribute, termbox.Attribute) {
+	if selected, border := lr.sc.at(o); border {
+		bg = selectionBorderBg
+	} else if selected && bg != selectionBorderBg {
+		bg = selectionBg
+	}
+	if lr.sc.caret(o) {
+		fg |= lr.caretStyle
 	}
+	return fg, bg
+}
+
+// colours returns the colours of the cell showing offset o of the view.
+// Offsets must be passed in increasing order.
+func (lr *lineRenderer) colours(o int) (fg, bg termbox.Attribute) {
+	fg, bg, ok := lr.rc.at(o)
+	if !ok {
+		fg, bg = defaultFg, defaultBg
+	}
+
+	if highlighted, _ := lr.hc.at(o); highlighted {
+		fg, bg = findHighlightFg, findHighlightBg
+	}
+	if selected, border := lr.sc.at(o); border {
+		bg = selectionBorderBg
+	} else if selected {
+		bg = selectionBg
+	}
+
+	if lr.sc.caret(o) {
+		fg = fg | lr.caretStyle
+	}
+	return
+}
 
-	fg, bg = defaultFg, color256(render.Colour{28, 29, 26, 1})
-	y = t.window_layout.height - statusbarHeight
+func (t *tbfe) renderStatusBar(v *backend.View) {
+	tabSize := viewTabSize(v)
+
+	t.lock.Lock()
+	wl := t.window_layout
+	t.lock.Unlock()
+
+	fg, bg := defaultFg, overlayBg
+	y := wl.height - statusbarHeight
 	// Draw status bar bottom of window
-	for i := 0; i < t.window_layout.width; i++ {
-		termbox.SetCell(i, y, ' ', fg, bg)
+	for i := 0; i < wl.width; i++ {
+		scr.SetCell(i, y, ' ', fg, bg)
 	}
-	go t.renderLStatus(v, y, fg, bg)
+	t.renderLStatus(v, y, fg, bg)
 	// The right status
-	rns := []rune(fmt.Sprintf("Tab Size:%d   %s", tabSize, "Go"))
-	x = t.window_layout.width - 1 - len(rns)
+	rns := []rune(statusRight(tabSize))
+	x := wl.width - 1 - stringWidth(string(rns))
 	addRunes(x, y, rns, fg, bg)
 }
 
@@ -223,17 +526,17 @@ func (t *tbfe) renderLStatus(v *backend.View, y int, fg, bg termbox.Attribute) {
 		s := fmt.Sprintf("%d selection regions", l)
 		j = addString(j, y, s, fg, bg)
 	} else if r := sel.Get(0); r.Size() == 0 {
-		row, col := v.RowCol(r.A)
-		s := fmt.Sprintf("Line %d, Column %d", row+1, col)
+		row, _ := v.RowCol(r.A)
+		s := fmt.Sprintf("Line %d, Column %d", row+1, viewColumn(v, r.A))
 		j = addString(j, y, s, fg, bg)
 	} else {
 		ls := v.Lines(r)
 		s := v.Substr(r)
 		if len(ls) < 2 {
-			s := fmt.Sprintf("%d characters selected", len(s))
+			s := fmt.Sprintf("%d characters selected", utf8.RuneCountInString(s))
 			j = addString(j, y, s, fg, bg)
 		} else {
-			s := fmt.Sprintf("%d lines %d characters selected", len(ls), len(s))
+			s := fmt.Sprintf("%d lines %d characters selected", len(ls), utf8.RuneCountInString(s))
 			j = addString(j, y, s, fg, bg)
 		}
 	}
@@ -248,12 +551,17 @@ func (t *tbfe) clip(v *backend.View, s, e int) Region {
 	p := util.Prof.Enter("clip")
 	defer p.Exit()
 	t.lock.Lock()
-	h := t.layout[v].height
+	l := t.layout[v]
 	t.lock.Unlock()
-	if e-s > h {
-		e = s + h
-	} else if e-s < h {
-		s = e - h
+	h := l.height
+	if h < 1 {
+		h = 1
+	}
+	// Lines s to e, including e, are to be shown in h rows
+	if e-s+1 > h {
+		e = s + h - 1
+	} else if e-s+1 < h {
+		s = e - h + 1
 	}
 	if e2, _ := v.RowCol(v.TextPoint(e, 0)); e2 < e {
 		e = e2
@@ -261,7 +569,7 @@ func (t *tbfe) clip(v *backend.View, s, e int) Region {
 	if s < 0 {
 		s = 0
 	}
-	e = s + h
+	e = s + h - 1
 	r := Region{v.TextPoint(s, 0), v.TextPoint(e, 0)}
 	return v.LineR(r)
 }
@@ -275,6 +583,16 @@ func (t *tbfe) Show(v *backend.View, r Region) {
 
 	lv := l.visible
 
+	if wc, ok := viewWrap(v, l); ok {
+		l.visible = wc.show(v, lv, r, l.height)
+		l.scroll = 0
+		t.lock.Lock()
+		t.layout[v] = l
+		t.lock.Unlock()
+		t.render()
+		return
+	}
+
 	s1, _ := v.RowCol(lv.Begin())
 	e1, _ := v.RowCol(lv.End())
 	s2, _ := v.RowCol(r.Begin())
@@ -295,12 +613,23 @@ func (t *tbfe) Show(v *backend.View, r Region) {
 
 	r3 = t.clip(v, r3.A, r3.B)
 	l.visible = r3
+	l.scroll = hscroll(v, l)
 	t.lock.Lock()
 	t.layout[v] = l
 	t.lock.Unlock()
 	t.render()
 }
 
+// hscroll returns the horizontal scroll offset of v laid out as l that
+// keeps the caret of its last selection in view.
+func hscroll(v *backend.View, l layout) int {
+	rs := v.Sel().Regions()
+	if len(rs) == 0 {
+		return l.scroll
+	}
+	return scrollColumn(l.scroll, viewColumn(v, rs[len(rs)-1].B), l.width-gutterWidth(v))
+}
+
 func (t *tbfe) VisibleRegion(v *backend.View) Region {
 	t.lock.Lock()
 	r, ok := t.layout[v]
@@ -324,17 +653,6 @@ func (t *tbfe) ErrorMessage(msg string) {
 	log.Error(msg)
 }
 
-// TODO(q): Actually show a dialog
-func (t *tbfe) MessageDialog(msg string) {
-	log.Info(msg)
-}
-
-// TODO(q): Actually show a dialog
-func (t *tbfe) OkCancelDialog(msg, ok string) bool {
-	log.Info(msg, ok)
-	return false
-}
-
 func (t *tbfe) scroll(b Buffer) {
 	t.Show(backend.GetEditor().Console(), Region{b.Size(), b.Size()})
 }
@@ -347,34 +665,77 @@ func (t *tbfe) Inserted(changed_buffer Buffer, region_inserted Region, data_inse
 	t.scroll(changed_buffer)
 }
 
-func (t *tbfe) Prompt(title, folder string, flags int) []string {
-	return nil
-}
-
 func (t *tbfe) setupCallbacks(view *backend.View) {
 	// Ensure that the visible region currently presented is
-	// inclusive of the insert/erase delta.
+	// inclusive of the insert/erase delta, and that the lines it
+	// touches are rendered again.
 	view.AddObserver(&tbfeBufferDeltaObserver{t: t, view: view})
 
 	backend.OnNew.Add(func(v *backend.View) {
-		v.Settings().AddOnChange("lime.frontend.termbox.render", func(name string) { t.render() })
+		v.AddObserver(&tbfeBufferDeltaObserver{t: t, view: v})
+		v.Settings().AddOnChange("lime.frontend.termbox.render", func(name string) {
+			// Parsing the view again only changes its colours, unless
+			// it's wrapped depending on whether it's source code
+			if name == "lime.syntax.updated" && v.Settings().Get("word_wrap", false) != "auto" {
+				t.recolor(v)
+			} else {
+				t.invalidate(v)
+			}
+			t.render()
+		})
+	})
+
+	backend.OnNew.Add(t.viewOpened)
+	backend.OnLoad.Add(t.viewOpened)
+
+	backend.OnClose.Add(func(v *backend.View) {
+		t.lock.Lock()
+		t.removeView(v)
+		t.lock.Unlock()
+		t.relayout()
 	})
 
 	backend.OnModified.Add(func(v *backend.View) {
+		t.followCaret(v)
 		t.render()
 	})
 
 	backend.OnSelectionModified.Add(func(v *backend.View) {
+		t.followCaret(v)
 		t.render()
 	})
 }
 
+// followCaret makes the next render of v scroll to its selection.
+func (t *tbfe) followCaret(v *backend.View) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if l, ok := t.layout[v]; ok {
+		l.follow = true
+		t.layout[v] = l
+	}
+}
+
+// viewOpened puts views opened in the frontend's window into the
+// active group.
+func (t *tbfe) viewOpened(v *backend.View) {
+	t.lock.Lock()
+	if t.groups == nil || v.Window() != t.currentWindow {
+		t.lock.Unlock()
+		return
+	}
+	t.addView(v)
+	t.lock.Unlock()
+	t.relayout()
+}
+
 func (t *tbfe) setupEditor() *backend.Editor {
 	ed := backend.GetEditor()
 
 	ed.Init()
 	ed.SetDefaultPath("../packages/Default")
 	ed.SetUserPath("../packages/User")
+	addKeyBindings(ed)
 
 	return ed
 }
@@ -399,22 +760,39 @@ func (t *tbfe) renderthread() {
 				pc++
 			}
 		}()
-		termbox.Clear(defaultFg, defaultBg)
-
 		t.lock.Lock()
-		vs := make([]*backend.View, 0, len(t.layout))
-		ls := make([]layout, 0, len(t.layout))
-		for v, l := range t.layout {
-			vs = append(vs, v)
-			ls = append(ls, l)
+		vs := t.visibleViews()
+		ls := make([]layout, 0, len(vs))
+		for _, v := range vs {
+			ls = append(ls, t.layout[v])
 		}
+		cv := t.currentView
+		resized := t.resized
+		t.resized = false
 		t.lock.Unlock()
 
+		// Termbox only takes on the new size of the terminal when the
+		// screen is cleared. Otherwise the views draw all of their
+		// cells, so only the screen around them is.
+		if resized {
+			scr.Clear(defaultFg, defaultBg)
+		} else {
+			clearAround(ls)
+		}
+
 		for i, v := range vs {
 			t.renderView(v, ls[i])
 		}
+		t.renderTabs()
+		t.renderBorders()
+		t.renderInputPanel()
+		if cv != nil {
+			t.renderStatusBar(cv)
+		}
+		t.renderOverlay()
 
-		termbox.Flush()
+		scr.Flush()
+		t.flushEscapes()
 	}
 
 	for range t.dorender {
@@ -422,47 +800,45 @@ func (t *tbfe) renderthread() {
 	}
 }
 
+// clearAround blanks the cells of the screen outside of the views laid
+// out as ls.
+func clearAround(ls []layout) {
+	w, h := scr.Size()
+	for y := 0; y < h; y++ {
+	next:
+		for x := 0; x < w; x++ {
+			for _, l := range ls {
+				if x >= l.x && x < l.x+l.width && y >= l.y && y < l.y+l.height {
+					x = l.x + l.width - 1
+					continue next
+				}
+			}
+			scr.SetCell(x, y, ' ', defaultFg, defaultBg)
+		}
+	}
+}
+
 func (t *tbfe) handleResize(height, width int, init bool) {
-	// This should handle multiple views in a less hardcoded fashion.
-	// After all, it is possible to *not* have a view in a window.
 	t.lock.Lock()
 	if init {
-		t.layout[t.currentView] = layout{0, 0, 0, 0, Region{}, 0}
-		t.window_layout = layout{0, 0, 0, 0, Region{}, 0}
-		t.layout[t.console] = layout{0, 0, 0, 0, Region{}, 0}
+		t.window_layout = layout{}
+		t.layout[t.console] = layout{}
 	}
 
 	t.window_layout.height = height
 	t.window_layout.width = width
-
-	view_layout := t.layout[t.currentView]
-	view_layout.height = height - statusbarHeight
-	view_layout.width = width
-	t.layout[t.currentView] = view_layout
-	if *showConsole {
-		view_layout := t.layout[t.currentView]
-		view_layout.height = height - *consoleHeight - statusbarHeight - 1
-		view_layout.width = width
-
-		console_layout := t.layout[t.console]
-		console_layout.y = height - *consoleHeight - statusbarHeight
-		console_layout.width = width
-		console_layout.height = *consoleHeight
-
-		t.layout[t.console] = console_layout
-		t.layout[t.currentView] = view_layout
-	}
+	t.resized = true
 	t.lock.Unlock()
 
-	// Ensure that the new visible region is recalculated
-	t.Show(t.currentView, t.VisibleRegion(t.currentView))
+	// Ensure that the new visible regions are recalculated
+	t.relayout()
 }
 
-func (t *tbfe) handleInput(ev termbox.Event) {
-	if ev.Key == termbox.KeyCtrlQ {
-		t.shutdown <- true
+func (t *tbfe) handleInput(ev inputEvent) {
+	if ev.kp != nil {
+		t.handleKeyPress(*ev.kp)
+		return
 	}
-
 	var kp keys.KeyPress
 	if ev.Ch != 0 {
 		kp.Key = keys.Key(ev.Ch)
@@ -470,13 +846,77 @@ func (t *tbfe) handleInput(ev termbox.Event) {
 	} else if v2, ok := lut[ev.Key]; ok {
 		kp = v2
 		kp.Text = string(kp.Key)
+	} else if ev.Key < termbox.KeySpace || ev.Key == termbox.KeyBackspace2 {
+		kp = ctrlKey(byte(ev.Key))
+		kp.Text = string(kp.Key)
 	} else {
 		return
 	}
+	// A key preceded by an escape is reported as pressed with alt
+	if ev.Mod&termbox.ModAlt != 0 {
+		kp.Alt = true
+	}
+
+	t.handleKeyPress(kp)
+}
+
+// handleKeyPress sends kp to the overlay or input panel if one is shown,
+// and to the editor otherwise.
+func (t *tbfe) handleKeyPress(kp keys.KeyPress) {
+	t.lock.Lock()
+	o, ip := t.overlay, t.inputPanel
+	t.lock.Unlock()
+	if o != nil {
+		o.handleInput(kp)
+		return
+	}
+	if ip != nil && ip.handleInput(kp) {
+		return
+	}
 
 	t.editor.HandleInput(kp)
 }
 
+// pasteKey is the key of the key press that carries pasted text to the
+// editor. The editor inserts the text of key presses that aren't bound to
+// a command, and nothing binds the object replacement character, so the
+// paste ends up inserted as a single edit in order with the keys typed
+// around it.
+const pasteKey keys.Key = '\ufffc'
+
+// handlePaste inserts text pasted into the terminal as a single edit,
+// rather than typing it key by key. Overlays get it typed, one rune at a
+// time, as they handle text input themselves. Control characters are left
+// out of text pasted into overlays, and line breaks out of text pasted
+// into the input panel.
+func (t *tbfe) handlePaste(text string) {
+	// Terminals send line breaks as typed, which is a carriage return
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	text = strings.Replace(text, "\r", "\n", -1)
+
+	t.lock.Lock()
+	o, ip := t.overlay, t.inputPanel
+	t.lock.Unlock()
+	if o != nil {
+		// Line breaks and tabs would be taken as keys, like a tab
+		// completing in the file browser, so they're left out
+		for _, r := range text {
+			if !unicode.IsControl(r) {
+				o.handleInput(keys.KeyPress{Key: keys.Key(r), Text: string(r)})
+			}
+		}
+		return
+	}
+	// The input panel only holds a single line
+	if ip != nil {
+		text = strings.Replace(text, "\n", "", -1)
+	}
+
+	if text != "" {
+		t.editor.HandleInput(keys.KeyPress{Key: pasteKey, Text: text})
+	}
+}
+
 func (t *tbfe) loop() {
 	timechan := make(chan bool, 0)
 
@@ -503,27 +943,34 @@ func (t *tbfe) loop() {
 	}
 
 	// Due to termbox still running, we can't close evchan
-	evchan := make(chan termbox.Event, 32)
-	go func() {
-		for {
-			evchan <- termbox.PollEvent()
-		}
-	}()
+	evchan := make(chan inputEvent, 32)
+	quit := make(chan bool)
+	defer close(quit)
+	go pollEvents(scr, evchan, quit)
 
 	for {
 		p := util.Prof.Enter("mainloop")
 		select {
 		case ev := <-evchan:
 			mp := util.Prof.Enter("evchan")
-			switch ev.Type {
-			case termbox.EventError:
+			switch {
+			case ev.kp != nil:
+				t.handleInput(ev)
+				blink = false
+			case ev.paste != nil:
+				t.handlePaste(*ev.paste)
+				blink = false
+			case ev.Type == termbox.EventError:
 				log.Debug("error occured")
 				return
-			case termbox.EventResize:
+			case ev.Type == termbox.EventResize:
 				t.handleResize(ev.Height, ev.Width, false)
-			case termbox.EventKey:
+			case ev.Type == termbox.EventKey:
 				t.handleInput(ev)
 				blink = false
+			case ev.Type == termbox.EventMouse:
+				t.handleMouse(ev.Event)
+				blink = false
 			}
 			mp.Exit()
 
@@ -539,16 +986,27 @@ func (t *tbfe) loop() {
 }
 
 func (bdo *tbfeBufferDeltaObserver) Erased(changed_buffer Buffer, region_removed Region, data_removed []rune) {
+	// The lines the erased text spanned are joined into the one it began on
+	row, _ := changed_buffer.RowCol(region_removed.Begin())
+	bdo.t.edited(bdo.view, row, row, -strings.Count(string(data_removed), "\n"))
 	ensureVisibleRegionContainsInsertOrEraseDelta(bdo.t, bdo.view, region_removed.A-region_removed.B)
 }
 
 func (bdo *tbfeBufferDeltaObserver) Inserted(changed_buffer Buffer, region_inserted Region, data_inserted []rune) {
+	row, _ := changed_buffer.RowCol(region_inserted.Begin())
+	end, _ := changed_buffer.RowCol(region_inserted.End())
+	bdo.t.edited(bdo.view, row, end, end-row)
 	ensureVisibleRegionContainsInsertOrEraseDelta(bdo.t, bdo.view, region_inserted.B-region_inserted.A)
 }
 
 func ensureVisibleRegionContainsInsertOrEraseDelta(t *tbfe, view *backend.View, delta int) {
 	t.lock.Lock()
-	visible := t.layout[view].visible
+	l, ok := t.layout[view]
 	t.lock.Unlock()
+	// Views that aren't laid out are shown when they are
+	if !ok {
+		return
+	}
+	visible := l.visible
 	t.Show(view, Region{visible.Begin(), visible.End() + delta})
 }
@@ -0,0 +1,263 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/limetext/backend"
+	. "github.com/limetext/text"
+	"github.com/nsf/termbox-go"
+)
+
+var (
+	update = flag.Bool("update", false, "Write the rendered screens to the golden files")
+	// The packages in testdata are loaded once, for the cases with a syntax
+	loadPackages sync.Once
+)
+
+// goldenCase is a view rendered by itself on a screen of the given size,
+// and compared to the golden files of the same name in testdata/golden:
+// name.txt has the text of the screen, and name.attr its colours and
+// attributes. Regenerate them by running the tests with -update.
+type goldenCase struct {
+	name string
+	// The file shown, in testdata
+	file string
+	// The syntax and colour scheme of the view, if any
+	syntax, scheme string
+	settings       map[string]interface{}
+	sel            []Region
+	width, height  int
+}
+
+func TestGolden(t *testing.T) {
+	tests := []goldenCase{
+		{name: "plain", file: "sample.go", width: 40, height: 8},
+		{
+			name:  "selection",
+			file:  "sample.go",
+			sel:   []Region{{8, 14}, {53, 48}, {66, 66}},
+			width: 40, height: 8,
+		},
+		{
+			name:     "wrap",
+			file:     "sample.go",
+			settings: map[string]interface{}{"word_wrap": true},
+			sel:      []Region{{132, 132}},
+			width:    24, height: 10,
+		},
+		{
+			name:  "scrolled",
+			file:  "sample.go",
+			sel:   []Region{{132, 132}},
+			width: 24, height: 4,
+		},
+		{
+			name:     "no_line_numbers",
+			file:     "sample.go",
+			settings: map[string]interface{}{"line_numbers": false, "tab_size": 8},
+			sel:      []Region{{66, 66}},
+			width:    40, height: 8,
+		},
+	}
+
+	for _, test := range tests {
+		text, attrs, err := renderGolden(test)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		compareGolden(t, test.name+".txt", text)
+		compareGolden(t, test.name+".attr", attrs)
+	}
+}
+
+// compareGolden compares got to the golden file name, or replaces the file
+// with it when updating.
+func compareGolden(t *testing.T, name, got string) {
+	fn := filepath.Join("testdata", "golden", name)
+	if *update {
+		if err := ioutil.WriteFile(fn, []byte(got), 0644); err != nil {
+			t.Error(err)
+		}
+		return
+	}
+	exp, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Errorf("%s, run the tests with -update to create it", err)
+		return
+	}
+	if string(exp) != got {
+		t.Errorf("%s: Expected\n%s\nbut got\n%s", name, exp, got)
+	}
+}
+
+// renderGolden renders the view of c on a screen in memory, and returns
+// the screen as it's kept in the golden files.
+func renderGolden(c goldenCase) (string, string, error) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", c.file))
+	if err != nil {
+		return "", "", err
+	}
+
+	mode := *colorMode
+	*colorMode = "256"
+	defer func() { *colorMode = mode }()
+	defer saveColors()()
+	setColorMode()
+
+	ed := backend.GetEditor()
+	if c.syntax != "" {
+		// The syntaxes are loaded when a packages path is added
+		loadPackages.Do(func() {
+			ed.Init()
+			ed.AddPackagesPath(filepath.Join("testdata", "packages"))
+		})
+	}
+	w := ed.NewWindow()
+	defer w.Close()
+	v := w.NewFile()
+	defer func() {
+		v.SetScratch(true)
+		v.Close()
+	}()
+	for name, val := range c.settings {
+		v.Settings().Set(name, val)
+	}
+	if c.syntax != "" {
+		v.Settings().Set("syntax", c.syntax)
+	}
+	if c.scheme != "" {
+		v.Settings().Set("color_scheme", c.scheme)
+		ed.Settings().Set("color_scheme", c.scheme)
+		defer ed.Settings().Erase("color_scheme")
+		setSchemeSettings(ed)
+	}
+	edit := v.BeginEdit()
+	v.Insert(edit, 0, string(data))
+	v.EndEdit(edit)
+	if c.syntax != "" {
+		if err := waitForSyntax(v); err != nil {
+			return "", "", err
+		}
+	}
+	if len(c.sel) > 0 {
+		v.Sel().Clear()
+		v.Sel().AddAll(c.sel)
+	}
+
+	s := newMemScreen(c.width, c.height)
+	old := scr
+	scr = s
+	defer func() { scr = old }()
+
+	fe := &tbfe{
+		layout:     make(map[*backend.View]layout),
+		highlights: make(map[*backend.View][]Region),
+		caches:     make(map[*backend.View]*viewCache),
+		editor:     ed,
+	}
+	fe.layout[v] = layout{width: c.width, height: c.height}
+	sel := v.Sel().Regions()
+	fe.Show(v, sel[len(sel)-1])
+
+	s.Clear(defaultFg, defaultBg)
+	fe.renderView(v, fe.layout[v])
+	s.Flush()
+	text, attrs := dumpScreen(s)
+	return text, attrs, nil
+}
+
+// saveColors returns a function that puts back the colour mode and the
+// colours of the frontend as they are now, for tests that change them.
+func saveColors() func() {
+	mode := termbox.SetOutputMode(termbox.OutputCurrent)
+	n := colors
+	old := []termbox.Attribute{defaultFg, defaultBg, selectionBg, selectionBorderBg, findHighlightBg, findHighlightFg, overlayBg}
+	return func() {
+		termbox.SetOutputMode(mode)
+		colors = n
+		defaultFg, defaultBg, selectionBg, selectionBorderBg, findHighlightBg, findHighlightFg, overlayBg = old[0], old[1], old[2], old[3], old[4], old[5], old[6]
+	}
+}
+
+// waitForSyntax waits for the syntax of v to be parsed, which is done in
+// the background after the text changes.
+func waitForSyntax(v *backend.View) error {
+	for i := 0; i < 100; i++ {
+		if n, ok := v.Settings().Get("lime.syntax.updated").(int); ok && n == v.ChangeCount() {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return fmt.Errorf("the view wasn't parsed with %s in time", v.Settings().Get("syntax"))
+}
+
+// dumpScreen returns the text of the cells flushed to s, and their
+// attributes. Each different pair of foreground and background attributes
+// is given a letter, listed at the top with what it stands for.
+func dumpScreen(s *memScreen) (string, string) {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	var (
+		text, grid bytes.Buffer
+		legend     []string
+		codes      = make(map[[2]termbox.Attribute]byte)
+	)
+	for y := 0; y < s.height; y++ {
+		var line []rune
+		for x := 0; x < s.width; x++ {
+			c := s.flushed[y*s.width+x]
+			key := [2]termbox.Attribute{c.Fg, c.Bg}
+			code, ok := codes[key]
+			if !ok {
+				code = letters[len(codes)%len(letters)]
+				codes[key] = code
+				legend = append(legend, fmt.Sprintf("%c fg=%s bg=%s", code, attrName(c.Fg), attrName(c.Bg)))
+			}
+			grid.WriteByte(code)
+
+			// The cell after a wide rune is covered by it
+			if x > 0 && runeWidth(s.flushed[y*s.width+x-1].Ch) == 2 {
+				continue
+			}
+			if c.Ch == 0 {
+				c.Ch = ' '
+			}
+			line = append(line, c.Ch)
+		}
+		grid.WriteByte('\n')
+		text.WriteString(strings.TrimRight(string(line), " ") + "\n")
+	}
+	return text.String(), strings.Join(legend, "\n") + "\n\n" + grid.String()
+}
+
+// attrName returns the colour and the attributes of a as text, like
+// "15+bold".
+func attrName(a termbox.Attribute) string {
+	name := fmt.Sprint(a & (termbox.AttrBold - 1))
+	for _, attr := range []struct {
+		attr termbox.Attribute
+		name string
+	}{
+		{termbox.AttrBold, "bold"},
+		{termbox.AttrCursive, "italic"},
+		{termbox.AttrUnderline, "underline"},
+		{termbox.AttrReverse, "reverse"},
+	} {
+		if a&attr.attr != 0 {
+			name += "+" + attr.name
+		}
+	}
+	return name
+}
@@ -0,0 +1,221 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/keys"
+	. "github.com/limetext/text"
+)
+
+// inputPanel is the single line minibuffer behind show_input_panel. It's
+// backed by a view of its own, so the usual editing keys work in it.
+type inputPanel struct {
+	t        *tbfe
+	lock     sync.Mutex
+	caption  string
+	view     *backend.View
+	prevView *backend.View
+	onDone   func(string)
+	onChange func(string)
+	onCancel func()
+	// Closed when the callback called last has returned
+	lastCall chan struct{}
+}
+
+// HideInputPanelCommand closes the input panel, as if enter was pressed
+// in it if Done is set and as if escape was otherwise.
+type HideInputPanelCommand struct {
+	backend.DefaultCommand
+	Done bool
+}
+
+const inputPanelHeight = 1
+
+// inputPanelEnter and inputPanelEscape are the keys the editor gets in
+// place of enter and escape pressed in the input panel, which are bound
+// to hide_input_panel. The editor inserts the keys typed into the panel
+// as it gets to them, so closing the panel in order with them leaves
+// none out of its text, and none typed before enter end up in the view
+// focused after it. Nothing else binds these private use characters.
+const (
+	inputPanelEnter  keys.Key = '\ue000'
+	inputPanelEscape keys.Key = '\ue001'
+)
+
+var inputPanelBindings = []*keys.KeyBinding{
+	{
+		Keys:    []keys.KeyPress{{Key: inputPanelEnter}},
+		Command: "hide_input_panel",
+		Args:    map[string]interface{}{"done": true},
+	},
+	{
+		Keys:    []keys.KeyPress{{Key: inputPanelEscape}},
+		Command: "hide_input_panel",
+		Args:    map[string]interface{}{"done": false},
+	},
+}
+
+// ShowInputPanel shows a line of text input above the status bar, filled
+// in with initial, and returns the view backing it. onChange is called
+// whenever the text changes, onDone with the text when enter is pressed
+// and onCancel when the panel is closed with escape. Any of the
+// callbacks can be nil. They're called in order, off the main loop. Showing a panel replaces the one shown already,
+// cancelling it.
+func (t *tbfe) ShowInputPanel(caption, initial string, onDone, onChange func(string), onCancel func()) *backend.View {
+	t.lock.Lock()
+	old := t.inputPanel
+	t.lock.Unlock()
+	if old != nil {
+		old.close(false)
+	}
+
+	ip := &inputPanel{
+		t:        t,
+		caption:  caption,
+		prevView: t.currentWindow.ActiveView(),
+		onDone:   onDone,
+		onChange: onChange,
+		onCancel: onCancel,
+	}
+
+	v := t.currentWindow.NewFile()
+	v.SetScratch(true)
+	v.Settings().Set("is_widget", true)
+	v.Settings().Set("line_numbers", false)
+	if initial != "" {
+		e := v.BeginEdit()
+		v.Insert(e, 0, initial)
+		v.EndEdit(e)
+	}
+	v.Sel().Clear()
+	v.Sel().Add(Region{v.Size(), v.Size()})
+	v.AddObserver(ip)
+	ip.view = v
+
+	t.lock.Lock()
+	// The view was put in a group when it was created, but it's only
+	// ever shown as the panel.
+	t.removeView(v)
+	t.layout[v] = layout{}
+	t.inputPanel = ip
+	t.lock.Unlock()
+
+	t.currentWindow.SetActiveView(v)
+	t.relayout()
+	return v
+}
+
+// call calls f in a goroutine of its own, once the callbacks called
+// before it have returned.
+func (ip *inputPanel) call(f func()) {
+	ip.lock.Lock()
+	prev, done := ip.lastCall, make(chan struct{})
+	ip.lastCall = done
+	ip.lock.Unlock()
+
+	go func() {
+		if prev != nil {
+			<-prev
+		}
+		f()
+		close(done)
+	}()
+}
+
+func (ip *inputPanel) text() string {
+	return ip.view.Substr(Region{0, ip.view.Size()})
+}
+
+// close hides the panel, calling onDone if done is set and onCancel
+// otherwise, and gives the input focus back to the view that had it.
+func (ip *inputPanel) close(done bool) {
+	t := ip.t
+	t.lock.Lock()
+	if t.inputPanel != ip {
+		t.lock.Unlock()
+		return
+	}
+	t.inputPanel = nil
+	delete(t.layout, ip.view)
+	t.lock.Unlock()
+
+	s := ip.text()
+	ip.view.RemoveObserver(ip)
+	ip.view.Close()
+	if ip.prevView != nil {
+		t.currentWindow.SetActiveView(ip.prevView)
+	}
+	t.relayout()
+
+	if done && ip.onDone != nil {
+		ip.call(func() { ip.onDone(s) })
+	} else if !done && ip.onCancel != nil {
+		ip.call(ip.onCancel)
+	}
+}
+
+// handleInput sends enter and escape to the editor as the keys closing
+// the panel, and reports whether the key was used. Every other key goes
+// to the editor as usual.
+func (ip *inputPanel) handleInput(kp keys.KeyPress) bool {
+	if kp.Ctrl || kp.Alt || kp.Super || kp.Shift {
+		return false
+	}
+	switch kp.Key {
+	case keys.Enter:
+		ip.t.editor.HandleInput(keys.KeyPress{Key: inputPanelEnter})
+	case keys.Escape:
+		ip.t.editor.HandleInput(keys.KeyPress{Key: inputPanelEscape})
+	default:
+		return false
+	}
+	return true
+}
+
+func (ip *inputPanel) changed() {
+	if ip.onChange != nil {
+		s := ip.text()
+		ip.call(func() { ip.onChange(s) })
+	}
+}
+
+func (ip *inputPanel) Erased(changed_buffer Buffer, region_removed Region, data_removed []rune) {
+	ip.changed()
+}
+
+func (ip *inputPanel) Inserted(changed_buffer Buffer, region_inserted Region, data_inserted []rune) {
+	ip.changed()
+}
+
+func (c *HideInputPanelCommand) Run(w *backend.Window) error {
+	t := frontend()
+	if t == nil {
+		return errNoFrontend
+	}
+	t.lock.Lock()
+	ip := t.inputPanel
+	t.lock.Unlock()
+	if ip != nil {
+		ip.close(c.Done)
+	}
+	return nil
+}
+
+func (t *tbfe) renderInputPanel() {
+	t.lock.Lock()
+	ip := t.inputPanel
+	var l layout
+	if ip != nil {
+		l = t.layout[ip.view]
+	}
+	t.lock.Unlock()
+
+	if ip != nil {
+		addString(0, l.y, ip.caption, defaultFg, defaultBg)
+	}
+}
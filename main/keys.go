@@ -0,0 +1,456 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"time"
+	"unicode/utf8"
+
+	"github.com/limetext/backend/keys"
+	"github.com/nsf/termbox-go"
+)
+
+type (
+	// inputEvent is either a termbox event, or a key press or paste the
+	// frontend decoded itself.
+	inputEvent struct {
+		termbox.Event
+		kp    *keys.KeyPress
+		paste *string
+	}
+
+	// rawInput is what was read from the terminal in one go.
+	rawInput struct {
+		ev   termbox.Event
+		data []byte
+	}
+)
+
+const (
+	// escDelay is how long we wait for the rest of an escape sequence
+	// before deciding that a lone escape byte was the escape key.
+	escDelay = 50 * time.Millisecond
+	// mouseDelay is how long we wait for the rest of a mouse report
+	// before dropping it. Mouse reports are never typed, so unlike key
+	// sequences there's nothing else the start of one could be.
+	mouseDelay = time.Second
+	// pasteDelay is how long we wait for the end of a paste before
+	// taking what we got as the whole of it. It's only a safety net for
+	// a lost end marker, so it's much longer than escDelay: a paste may
+	// arrive in many reads with pauses in between.
+	pasteDelay = 3 * time.Second
+)
+
+// The sequences around text pasted while bracketed paste mode is on
+const (
+	pasteStart = "\x1b[200~"
+	pasteEnd   = "\x1b[201~"
+)
+
+var (
+	// Final bytes of the "CSI X", "CSI 1 ; modifier X" and "SS3 X"
+	// sequences
+	csiFinalKeys = map[byte]keys.Key{
+		'A': keys.Up,
+		'B': keys.Down,
+		'C': keys.Right,
+		'D': keys.Left,
+		'H': keys.Home,
+		'F': keys.End,
+		'P': keys.F1,
+		'Q': keys.F2,
+		'R': keys.F3,
+		'S': keys.F4,
+	}
+
+	// Parameters of the "CSI number ~" and "CSI number ; modifier ~"
+	// sequences
+	csiTildeKeys = map[int]keys.Key{
+		1:  keys.Home,
+		2:  keys.Insert,
+		3:  keys.Delete,
+		4:  keys.End,
+		5:  keys.PageUp,
+		6:  keys.PageDown,
+		7:  keys.Home,
+		8:  keys.End,
+		11: keys.F1,
+		12: keys.F2,
+		13: keys.F3,
+		14: keys.F4,
+		15: keys.F5,
+		17: keys.F6,
+		18: keys.F7,
+		19: keys.F8,
+		20: keys.F9,
+		21: keys.F10,
+		23: keys.F11,
+		24: keys.F12,
+	}
+
+	// Key codes of the "CSI 27 ; modifier ; code ~" and "CSI code ;
+	// modifier u" sequences that aren't the rune of the key
+	csiCodeKeys = map[int]keys.Key{
+		8:   keys.Backspace,
+		9:   '\t',
+		13:  keys.Enter,
+		27:  keys.Escape,
+		127: keys.Backspace,
+	}
+)
+
+// ctrlKey returns the key press sent as the control byte c.
+//
+// Several keys send the same byte, and for those we pick the key the
+// default key bindings use: ctrl+space over ctrl+2 and ctrl+@, ctrl+\
+// over ctrl+4, ctrl+] over ctrl+5 and ctrl+/ over ctrl+7 and ctrl+_.
+// Backspace, tab, enter and escape win over ctrl+h, ctrl+i, ctrl+m and
+// ctrl+[, except that most terminals send backspace as DEL, which leaves
+// the backspace byte to ctrl+h. Timing can't tell escape and ctrl+[
+// apart either: both are a lone escape byte with nothing after it, and
+// escDelay only separates that from an escape sequence or alt+key.
+// Terminals supporting xterm's modifyOtherKeys send all the colliding
+// keys as distinct sequences, see parseCSI.
+func ctrlKey(c byte) keys.KeyPress {
+	switch c {
+	case 0x00:
+		return keys.KeyPress{Key: ' ', Ctrl: true}
+	case 0x09:
+		return keys.KeyPress{Key: '\t'}
+	case 0x0d:
+		return keys.KeyPress{Key: keys.Enter}
+	case 0x1b:
+		return keys.KeyPress{Key: keys.Escape}
+	case 0x1c:
+		return keys.KeyPress{Key: '\\', Ctrl: true}
+	case 0x1d:
+		return keys.KeyPress{Key: ']', Ctrl: true}
+	case 0x1e:
+		return keys.KeyPress{Key: '6', Ctrl: true}
+	case 0x1f:
+		return keys.KeyPress{Key: '/', Ctrl: true}
+	case 0x7f:
+		return keys.KeyPress{Key: keys.Backspace}
+	}
+	return keys.KeyPress{Key: keys.Key('a' + c - 1), Ctrl: true}
+}
+
+// isCtrlByte reports whether c is sent by a key pressed together with
+// ctrl or by one of the keys ctrlKey knows about.
+func isCtrlByte(c byte) bool {
+	return c < 0x20 || c == 0x7f
+}
+
+// seqLen returns the length of the CSI or SS3 escape sequence data starts
+// with, or 0 if the sequence isn't complete yet.
+func seqLen(data []byte) int {
+	if len(data) < 3 {
+		return 0
+	}
+	if data[1] == 'O' {
+		return 3
+	}
+	for i := 2; i < len(data); i++ {
+		// Parameter bytes are in 0x30-0x3f and the final byte in
+		// 0x40-0x7e, but be lenient about what comes before it
+		if data[i] >= 0x40 && data[i] <= 0x7e {
+			return i + 1
+		}
+		if data[i] < 0x20 {
+			return i
+		}
+	}
+	return 0
+}
+
+// mouseLen returns the length of the mouse report data starts with, or 0
+// if it isn't complete yet. It reports false if data doesn't start with
+// one. X10 reports are "CSI M" followed by three bytes, and SGR reports
+// are "CSI < button ; x ; y" ending in M or m.
+func mouseLen(data []byte) (int, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x1b[M")):
+		if len(data) < 6 {
+			return 0, true
+		}
+		return 6, true
+	case bytes.HasPrefix(data, []byte("\x1b[<")):
+		for i := 3; i < len(data); i++ {
+			switch c := data[i]; {
+			case c == 'M' || c == 'm':
+				return i + 1, true
+			case (c < '0' || c > '9') && c != ';':
+				return 0, false
+			}
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// parseCSI decodes the complete CSI or SS3 escape sequence seq sent by a
+// special key, such as "\x1b[1;2A" for shift+up, including xterm's
+// modifyOtherKeys and the "CSI u" sequences. It reports false if seq
+// isn't a key sequence it knows.
+func parseCSI(seq []byte) (kp keys.KeyPress, ok bool) {
+	if len(seq) < 3 || seq[0] != '\x1b' {
+		return kp, false
+	}
+	final := seq[len(seq)-1]
+	if seq[1] == 'O' {
+		kp.Key, ok = csiFinalKeys[final]
+		kp.Text = string(kp.Key)
+		return kp, ok
+	}
+	if seq[1] != '[' {
+		return kp, false
+	}
+
+	var params []int
+	p, digits := 0, false
+	for _, c := range seq[2 : len(seq)-1] {
+		switch {
+		case c >= '0' && c <= '9':
+			p = p*10 + int(c-'0')
+			digits = true
+		case c == ';':
+			params = append(params, p)
+			p, digits = 0, false
+		default:
+			// Private sequences such as mouse reports
+			return kp, false
+		}
+	}
+	if digits {
+		params = append(params, p)
+	}
+
+	mod := 1
+	switch {
+	case final == 'Z' && len(params) == 0:
+		// Back tab
+		kp.Key, mod = '\t', 2
+	case final == '~' && len(params) == 3 && params[0] == 27:
+		// modifyOtherKeys
+		kp.Key, mod = codeKey(params[2]), params[1]
+	case final == 'u' && (len(params) == 1 || len(params) == 2):
+		kp.Key = codeKey(params[0])
+		if len(params) == 2 {
+			mod = params[1]
+		}
+	case final == '~' && (len(params) == 1 || len(params) == 2):
+		if kp.Key, ok = csiTildeKeys[params[0]]; !ok {
+			return kp, false
+		}
+		if len(params) == 2 {
+			mod = params[1]
+		}
+	case len(params) == 0 || (len(params) == 2 && params[0] == 1):
+		if kp.Key, ok = csiFinalKeys[final]; !ok {
+			return kp, false
+		}
+		if len(params) == 2 {
+			mod = params[1]
+		}
+	default:
+		return kp, false
+	}
+	setCSIModifiers(&kp, mod)
+	kp.Text = string(kp.Key)
+	return kp, true
+}
+
+// codeKey returns the key with the given code in a modifyOtherKeys or
+// "CSI u" sequence.
+func codeKey(code int) keys.Key {
+	if k, ok := csiCodeKeys[code]; ok {
+		return k
+	}
+	return keys.Key(code)
+}
+
+// setCSIModifiers sets the modifiers of kp from the modifier parameter of
+// an xterm sequence, which is one more than a bitmask of shift, alt, ctrl
+// and meta.
+func setCSIModifiers(kp *keys.KeyPress, m int) {
+	m--
+	kp.Shift = m&1 != 0
+	kp.Alt = m&2 != 0
+	kp.Ctrl = m&4 != 0
+	kp.Super = m&8 != 0
+}
+
+// decodeKey decodes the first event in data, and returns it along with
+// the number of bytes it used. It returns 0 if more data is needed to
+// tell what the event is, unless no more data came for too long: idle is
+// how long ago data was last received.
+func decodeKey(data []byte, idle time.Duration) (inputEvent, int) {
+	flush := idle >= escDelay
+	c := data[0]
+	if n, ok := mouseLen(data); ok {
+		switch {
+		case n != 0:
+			return inputEvent{Event: termbox.ParseEvent(data[:n])}, n
+		case idle < mouseDelay:
+			return inputEvent{}, 0
+		}
+		// The rest of the report got lost
+		return inputEvent{Event: termbox.Event{Type: termbox.EventNone}}, len(data)
+	}
+	switch {
+	case c == '\x1b' && len(data) == 1:
+		if !flush {
+			return inputEvent{}, 0
+		}
+	case c == '\x1b' && (data[1] == '[' || data[1] == 'O'):
+		n := seqLen(data)
+		if n == 0 && !flush {
+			return inputEvent{}, 0
+		}
+		if n != 0 && string(data[:n]) == pasteStart {
+			return decodePaste(data, idle)
+		}
+		if n != 0 && string(data[:n]) == pasteEnd {
+			// The end of a paste we gave up waiting for
+			return inputEvent{Event: termbox.Event{Type: termbox.EventNone}}, n
+		}
+		if n != 0 {
+			if kp, ok := parseCSI(data[:n]); ok {
+				return inputEvent{kp: &kp}, n
+			}
+			// Mouse reports and whatever termbox knows about from
+			// the terminal's terminfo entry
+			if ev := termbox.ParseEvent(data); ev.N != 0 {
+				return inputEvent{Event: ev}, ev.N
+			}
+		}
+		// Not a sequence after all, so this is alt+[ or alt+O
+		fallthrough
+	case c == '\x1b':
+		ev, n := decodeKey(data[1:], idle)
+		if n == 0 {
+			return ev, 0
+		}
+		if ev.kp != nil {
+			ev.kp.Alt = true
+		} else {
+			ev.Mod |= termbox.ModAlt
+		}
+		return ev, n + 1
+	case !utf8.FullRune(data) && !flush:
+		return inputEvent{}, 0
+	}
+
+	if isCtrlByte(c) {
+		kp := ctrlKey(c)
+		kp.Text = string(kp.Key)
+		return inputEvent{kp: &kp}, 1
+	}
+	r, n := utf8.DecodeRune(data)
+	kp := keys.KeyPress{Key: keys.Key(r), Text: string(r)}
+	return inputEvent{kp: &kp}, n
+}
+
+// decodePaste returns the text pasted in data, which starts with
+// pasteStart. It waits for pasteEnd unless no more data came for
+// pasteDelay, in which case the text received so far is returned as the
+// paste.
+func decodePaste(data []byte, idle time.Duration) (inputEvent, int) {
+	text := data[len(pasteStart):]
+	n := len(data)
+	if i := bytes.Index(text, []byte(pasteEnd)); i >= 0 {
+		text = text[:i]
+		n = len(pasteStart) + i + len(pasteEnd)
+	} else if idle < pasteDelay {
+		return inputEvent{}, 0
+	}
+	s := string(text)
+	return inputEvent{paste: &s}, n
+}
+
+// pollEvents reads input from s and sends the events decoded from it on
+// evchan, until quit is closed.
+func pollEvents(s screen, evchan chan<- inputEvent, quit <-chan bool) {
+	// Input that comes in after quit is closed is dropped, until the
+	// interrupt sent then is reached
+	rawchan := make(chan rawInput, 32)
+	go func() {
+		for {
+			data := make([]byte, 32)
+			ev := s.PollEvent(data)
+			if ev.Type == termbox.EventInterrupt {
+				return
+			}
+			select {
+			case rawchan <- rawInput{ev, data[:ev.N]}:
+			case <-quit:
+			}
+		}
+	}()
+	defer s.Interrupt()
+
+	send := func(ev inputEvent) bool {
+		select {
+		case evchan <- ev:
+			return true
+		case <-quit:
+			return false
+		}
+	}
+
+	var (
+		data    []byte
+		last    time.Time
+		timeout <-chan time.Time
+	)
+	for {
+		select {
+		case in := <-rawchan:
+			if in.ev.Type != termbox.EventRaw {
+				if !send(inputEvent{Event: in.ev}) {
+					return
+				}
+				continue
+			}
+			data = append(data, in.data...)
+			last = time.Now()
+		case <-timeout:
+		case <-quit:
+			return
+		}
+
+		idle := time.Since(last)
+		for len(data) > 0 {
+			ev, n := decodeKey(data, idle)
+			if n == 0 {
+				break
+			}
+			if ev.kp != nil || ev.paste != nil || ev.Type != termbox.EventNone {
+				if !send(ev) {
+					return
+				}
+			}
+			data = data[n:]
+		}
+		timeout = nil
+		if len(data) > 0 {
+			timeout = time.After(escDelay)
+		}
+	}
+}
+
+// enableKeyReporting asks the terminal to send keys that would otherwise
+// be indistinguishable, such as ctrl+i and tab, as escape sequences with
+// their modifiers, and to mark the start and end of pasted text.
+// Terminals that don't support it ignore the request.
+func enableKeyReporting() {
+	scr.WriteRaw("\x1b[>4;2m\x1b[?2004h")
+}
+
+// disableKeyReporting undoes enableKeyReporting.
+func disableKeyReporting() {
+	scr.WriteRaw("\x1b[>4m\x1b[?2004l")
+}
@@ -0,0 +1,184 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/limetext/backend/keys"
+	"github.com/nsf/termbox-go"
+)
+
+func TestParseCSI(t *testing.T) {
+	tests := []struct {
+		seq string
+		exp keys.KeyPress
+		ok  bool
+	}{
+		{"\x1b[A", keys.KeyPress{Key: keys.Up}, true},
+		{"\x1bOD", keys.KeyPress{Key: keys.Left}, true},
+		{"\x1bOP", keys.KeyPress{Key: keys.F1}, true},
+		{"\x1b[1;2A", keys.KeyPress{Key: keys.Up, Shift: true}, true},
+		{"\x1b[1;3B", keys.KeyPress{Key: keys.Down, Alt: true}, true},
+		{"\x1b[1;5C", keys.KeyPress{Key: keys.Right, Ctrl: true}, true},
+		{"\x1b[1;6D", keys.KeyPress{Key: keys.Left, Shift: true, Ctrl: true}, true},
+		{"\x1b[H", keys.KeyPress{Key: keys.Home}, true},
+		{"\x1b[1;2F", keys.KeyPress{Key: keys.End, Shift: true}, true},
+		{"\x1b[1;9P", keys.KeyPress{Key: keys.F1, Super: true}, true},
+		{"\x1b[1~", keys.KeyPress{Key: keys.Home}, true},
+		{"\x1b[2~", keys.KeyPress{Key: keys.Insert}, true},
+		{"\x1b[3;5~", keys.KeyPress{Key: keys.Delete, Ctrl: true}, true},
+		{"\x1b[4~", keys.KeyPress{Key: keys.End}, true},
+		{"\x1b[24;8~", keys.KeyPress{Key: keys.F12, Shift: true, Alt: true, Ctrl: true}, true},
+		{"\x1b[Z", keys.KeyPress{Key: '\t', Shift: true}, true},
+		// modifyOtherKeys and CSI u
+		{"\x1b[27;5;105~", keys.KeyPress{Key: 'i', Ctrl: true}, true},
+		{"\x1b[27;5;9~", keys.KeyPress{Key: '\t', Ctrl: true}, true},
+		{"\x1b[27;5;91~", keys.KeyPress{Key: '[', Ctrl: true}, true},
+		{"\x1b[104;5u", keys.KeyPress{Key: 'h', Ctrl: true}, true},
+		{"\x1b[127;5u", keys.KeyPress{Key: keys.Backspace, Ctrl: true}, true},
+		{"\x1b[13u", keys.KeyPress{Key: keys.Enter}, true},
+		// Not key sequences
+		{"\x1b[9;2~", keys.KeyPress{}, false},
+		{"\x1b[<0;1;1M", keys.KeyPress{}, false},
+		{"\x1b[2J", keys.KeyPress{}, false},
+	}
+
+	for i, test := range tests {
+		kp, ok := parseCSI([]byte(test.seq))
+		if ok != test.ok {
+			t.Errorf("Test %d: Expected %v, but got %v", i, test.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		test.exp.Text = string(test.exp.Key)
+		if kp != test.exp {
+			t.Errorf("Test %d: Expected %v, but got %v", i, test.exp, kp)
+		}
+	}
+}
+
+func TestDecodeKey(t *testing.T) {
+	tests := []struct {
+		data string
+		idle time.Duration
+		exp  keys.KeyPress
+		n    int
+	}{
+		{"a", 0, keys.KeyPress{Key: 'a'}, 1},
+		{"é", 0, keys.KeyPress{Key: 'é'}, 2},
+		{"\xc3", 0, keys.KeyPress{}, 0},
+		{" ", 0, keys.KeyPress{Key: ' '}, 1},
+		{"\x00", 0, keys.KeyPress{Key: ' ', Ctrl: true}, 1},
+		{"\x01", 0, keys.KeyPress{Key: 'a', Ctrl: true}, 1},
+		{"\x08", 0, keys.KeyPress{Key: 'h', Ctrl: true}, 1},
+		{"\x7f", 0, keys.KeyPress{Key: keys.Backspace}, 1},
+		{"\t", 0, keys.KeyPress{Key: '\t'}, 1},
+		{"\r", 0, keys.KeyPress{Key: keys.Enter}, 1},
+		{"\n", 0, keys.KeyPress{Key: 'j', Ctrl: true}, 1},
+		{"\x11", 0, keys.KeyPress{Key: 'q', Ctrl: true}, 1},
+		{"\x1a", 0, keys.KeyPress{Key: 'z', Ctrl: true}, 1},
+		{"\x1c", 0, keys.KeyPress{Key: '\\', Ctrl: true}, 1},
+		{"\x1d", 0, keys.KeyPress{Key: ']', Ctrl: true}, 1},
+		{"\x1f", 0, keys.KeyPress{Key: '/', Ctrl: true}, 1},
+		// A lone escape is only the escape key once no more input came
+		{"\x1b", 0, keys.KeyPress{}, 0},
+		{"\x1b", escDelay, keys.KeyPress{Key: keys.Escape}, 1},
+		{"\x1b\x1b", escDelay, keys.KeyPress{Key: keys.Escape, Alt: true}, 2},
+		{"\x1bx", 0, keys.KeyPress{Key: 'x', Alt: true}, 2},
+		{"\x1b\x06", 0, keys.KeyPress{Key: 'f', Ctrl: true, Alt: true}, 2},
+		{"\x1b[", 0, keys.KeyPress{}, 0},
+		{"\x1b[", escDelay, keys.KeyPress{Key: '[', Alt: true}, 2},
+		{"\x1b[1;2", 0, keys.KeyPress{}, 0},
+		{"\x1b[1;2Ax", 0, keys.KeyPress{Key: keys.Up, Shift: true}, 6},
+		{"\x1b\x1b[A", 0, keys.KeyPress{Key: keys.Up, Alt: true}, 4},
+		{"\x1bOA", 0, keys.KeyPress{Key: keys.Up}, 3},
+	}
+
+	for i, test := range tests {
+		ev, n := decodeKey([]byte(test.data), test.idle)
+		if n != test.n {
+			t.Errorf("Test %d: Expected %d bytes to be used, but got %d", i, test.n, n)
+			continue
+		}
+		if n == 0 {
+			continue
+		}
+		if ev.kp == nil {
+			t.Errorf("Test %d: Expected a key press, but got %v", i, ev.Event)
+			continue
+		}
+		test.exp.Text = string(test.exp.Key)
+		if *ev.kp != test.exp {
+			t.Errorf("Test %d: Expected %v, but got %v", i, test.exp, *ev.kp)
+		}
+	}
+}
+
+func TestDecodePaste(t *testing.T) {
+	tests := []struct {
+		data string
+		idle time.Duration
+		exp  string
+		n    int
+	}{
+		{"\x1b[200~if a {\r\tb\r}\x1b[201~x", 0, "if a {\r\tb\r}", 23},
+		{"\x1b[200~\x1b[A\x1b[201~", 0, "\x1b[A", 15},
+		{"\x1b[200~abc", 0, "", 0},
+		{"\x1b[200~abc", escDelay, "", 0},
+		{"\x1b[200~abc", pasteDelay, "abc", 9},
+	}
+
+	for i, test := range tests {
+		ev, n := decodeKey([]byte(test.data), test.idle)
+		if n != test.n {
+			t.Errorf("Test %d: Expected %d bytes to be used, but got %d", i, test.n, n)
+			continue
+		}
+		if n == 0 {
+			continue
+		}
+		if ev.paste == nil {
+			t.Errorf("Test %d: Expected a paste, but got %v", i, ev)
+		} else if *ev.paste != test.exp {
+			t.Errorf("Test %d: Expected %q, but got %q", i, test.exp, *ev.paste)
+		}
+	}
+}
+
+func TestDecodeMouse(t *testing.T) {
+	tests := []struct {
+		data string
+		idle time.Duration
+		exp  termbox.Event
+		n    int
+	}{
+		{"\x1b[<0;10;5Mx", 0, termbox.Event{Type: termbox.EventMouse, Key: termbox.MouseLeft, MouseX: 9, MouseY: 4}, 10},
+		{"\x1b[<0;10;5m", 0, termbox.Event{Type: termbox.EventMouse, Key: termbox.MouseRelease, MouseX: 9, MouseY: 4}, 10},
+		{"\x1b[M *%", 0, termbox.Event{Type: termbox.EventMouse, Key: termbox.MouseLeft, MouseX: 9, MouseY: 4}, 6},
+		// Incomplete reports are waited for longer than key sequences
+		{"\x1b[<0;10", escDelay, termbox.Event{}, 0},
+		{"\x1b[M *", escDelay, termbox.Event{}, 0},
+		{"\x1b[<0;10", mouseDelay, termbox.Event{Type: termbox.EventNone}, 7},
+	}
+
+	for i, test := range tests {
+		ev, n := decodeKey([]byte(test.data), test.idle)
+		if n != test.n {
+			t.Errorf("Test %d: Expected %d bytes to be used, but got %d", i, test.n, n)
+			continue
+		}
+		if n == 0 {
+			continue
+		}
+		ev.N = 0
+		if ev.kp != nil || ev.Event != test.exp {
+			t.Errorf("Test %d: Expected %v, but got %v", i, test.exp, ev)
+		}
+	}
+}
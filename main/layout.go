@@ -0,0 +1,372 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/limetext/backend"
+)
+
+type (
+	// windowLayout describes how the window is split up into groups using
+	// the same representation as the set_layout command: cols and rows
+	// are the fractional positions of the grid lines, and each cell is
+	// an [x1, y1, x2, y2] quadruple of indices into cols and rows.
+	windowLayout struct {
+		cols  []float64
+		rows  []float64
+		cells [][4]int
+	}
+
+	// group is a single pane of the window, showing the active one
+	// of the views it holds.
+	group struct {
+		views  []*backend.View
+		active *backend.View
+		layout layout
+		// Whether a border is drawn on the right and bottom edge
+		// to separate the group from its neighbours.
+		rightBorder, bottomBorder bool
+	}
+
+	SetLayoutCommand struct {
+		backend.DefaultCommand
+		layout windowLayout
+	}
+
+	FocusGroupCommand struct {
+		backend.DefaultCommand
+		Group int
+	}
+)
+
+var singleLayout = windowLayout{
+	cols:  []float64{0, 1},
+	rows:  []float64{0, 1},
+	cells: [][4]int{{0, 0, 1, 1}},
+}
+
+func parseLayout(args backend.Args) (wl windowLayout, err error) {
+	if wl.cols, err = toFloats(args["cols"]); err != nil {
+		return wl, fmt.Errorf("cols: %s", err)
+	}
+	if wl.rows, err = toFloats(args["rows"]); err != nil {
+		return wl, fmt.Errorf("rows: %s", err)
+	}
+	cells, ok := args["cells"].([]interface{})
+	if !ok || len(cells) == 0 {
+		return wl, fmt.Errorf("cells: expected a list of cells, got %v", args["cells"])
+	}
+	for _, c := range cells {
+		fs, err := toFloats(c)
+		if err != nil || len(fs) != 4 {
+			return wl, fmt.Errorf("cells: expected [x1, y1, x2, y2], got %v", c)
+		}
+		wl.cells = append(wl.cells, [4]int{int(fs[0]), int(fs[1]), int(fs[2]), int(fs[3])})
+	}
+	return wl, wl.validate()
+}
+
+func toFloats(v interface{}) ([]float64, error) {
+	switch v := v.(type) {
+	case []float64:
+		return v, nil
+	case []interface{}:
+		ret := make([]float64, len(v))
+		for i, f := range v {
+			switch f := f.(type) {
+			case float64:
+				ret[i] = f
+			case int:
+				ret[i] = float64(f)
+			default:
+				return nil, fmt.Errorf("%v is not a number", f)
+			}
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("expected a list of numbers, got %v", v)
+}
+
+func (wl windowLayout) validate() error {
+	for _, l := range [][]float64{wl.cols, wl.rows} {
+		if len(l) < 2 {
+			return fmt.Errorf("layout needs at least two cols and rows")
+		}
+		for i, f := range l {
+			if f < 0 || f > 1 || (i > 0 && f <= l[i-1]) {
+				return fmt.Errorf("cols and rows should be ascending values between 0 and 1")
+			}
+		}
+	}
+	for _, c := range wl.cells {
+		if c[0] < 0 || c[1] < 0 || c[2] >= len(wl.cols) || c[3] >= len(wl.rows) ||
+			c[0] >= c[2] || c[1] >= c[3] {
+			return fmt.Errorf("invalid cell %v", c)
+		}
+	}
+	return nil
+}
+
+// rects returns the screen area of each cell when the layout is fit into
+// a w by h area at x, y. Space for a border is taken from the right and
+// bottom of every cell that doesn't touch the edge of the area.
+func (wl windowLayout) rects(x, y, w, h int) (ret []group) {
+	xs := make([]int, len(wl.cols))
+	for i, c := range wl.cols {
+		xs[i] = x + int(c*float64(w)+0.5)
+	}
+	ys := make([]int, len(wl.rows))
+	for i, r := range wl.rows {
+		ys[i] = y + int(r*float64(h)+0.5)
+	}
+
+	for _, c := range wl.cells {
+		var g group
+		g.layout.x, g.layout.y = xs[c[0]], ys[c[1]]
+		g.layout.width, g.layout.height = xs[c[2]]-xs[c[0]], ys[c[3]]-ys[c[1]]
+		if g.rightBorder = xs[c[2]] < x+w; g.rightBorder {
+			g.layout.width--
+		}
+		if g.bottomBorder = ys[c[3]] < y+h; g.bottomBorder {
+			g.layout.height--
+		}
+		ret = append(ret, g)
+	}
+	return
+}
+
+// setLayout replaces the window layout, moving the views of groups that
+// no longer exist into the last remaining group.
+// Must be called with t.lock held.
+func (t *tbfe) setLayout(wl windowLayout) {
+	n := len(wl.cells)
+	for len(t.groups) < n {
+		t.groups = append(t.groups, &group{})
+	}
+	if len(t.groups) > n {
+		last := t.groups[n-1]
+		for _, g := range t.groups[n:] {
+			last.views = append(last.views, g.views...)
+			if last.active == nil {
+				last.active = g.active
+			}
+		}
+		t.groups = t.groups[:n]
+	}
+	if t.activeGroup >= n {
+		t.activeGroup = n - 1
+	}
+	t.winLayout = wl
+}
+
+// arrange positions any docked overlay, the input panel and the console
+// above the status bar,
+// and the groups of the window layout in the area left above them. The
+// layout of every view in a group is set to the space below the group's
+// tab bar.
+// Must be called with t.lock held.
+func (t *tbfe) arrange() {
+	w, h := t.window_layout.width, t.window_layout.height-statusbarHeight
+	if d, ok := t.overlay.(dockedOverlay); ok {
+		h -= d.height()
+	}
+	if ip := t.inputPanel; ip != nil {
+		h -= inputPanelHeight
+		l := t.layout[ip.view]
+		l.x, l.y = stringWidth(ip.caption), h
+		l.width, l.height = w-l.x, inputPanelHeight
+		t.layout[ip.view] = l
+	}
+	if *showConsole {
+		h -= *consoleHeight
+		l := t.layout[t.console]
+		l.x, l.y = 0, h
+		l.width, l.height = w, *consoleHeight
+		t.layout[t.console] = l
+		// Leave a line between the console and the groups
+		h--
+	}
+	for i, r := range t.winLayout.rects(0, 0, w, h) {
+		g := t.groups[i]
+		g.layout, g.rightBorder, g.bottomBorder = r.layout, r.rightBorder, r.bottomBorder
+		for _, v := range g.views {
+			l := t.layout[v]
+			l.x, l.y = g.layout.x, g.layout.y+tabbarHeight
+			l.width, l.height = g.layout.width, g.layout.height-tabbarHeight
+			t.layout[v] = l
+		}
+	}
+}
+
+// groupOf returns the index of the group holding view v or -1.
+// Must be called with t.lock held.
+func (t *tbfe) groupOf(v *backend.View) int {
+	for i, g := range t.groups {
+		for _, gv := range g.views {
+			if gv == v {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// addView adds v to the active group and makes it the view shown there.
+// Must be called with t.lock held.
+func (t *tbfe) addView(v *backend.View) {
+	if t.groupOf(v) != -1 {
+		return
+	}
+	g := t.groups[t.activeGroup]
+	g.views = append(g.views, v)
+	g.active = v
+	t.currentView = v
+	if _, ok := t.layout[v]; !ok {
+		t.layout[v] = layout{}
+	}
+}
+
+// removeView removes v from the group holding it, showing the group's
+// previous view in its place.
+// Must be called with t.lock held.
+func (t *tbfe) removeView(v *backend.View) {
+	i := t.groupOf(v)
+	if i == -1 {
+		return
+	}
+	g := t.groups[i]
+	for j, gv := range g.views {
+		if gv != v {
+			continue
+		}
+		g.views = append(g.views[:j], g.views[j+1:]...)
+		if g.active == v {
+			g.active = nil
+			if j > 0 {
+				g.active = g.views[j-1]
+			} else if len(g.views) > 0 {
+				g.active = g.views[0]
+			}
+		}
+		break
+	}
+	delete(t.layout, v)
+	delete(t.caches, v)
+	if t.currentView == v {
+		t.currentView = t.groups[t.activeGroup].active
+	}
+}
+
+// focusGroup makes group i the one receiving input.
+func (t *tbfe) focusGroup(i int) {
+	t.lock.Lock()
+	if i < 0 || i >= len(t.groups) {
+		t.lock.Unlock()
+		return
+	}
+	t.activeGroup = i
+	v := t.groups[i].active
+	if v != nil {
+		t.currentView = v
+	}
+	t.lock.Unlock()
+
+	// Activating the view runs callbacks that call back into the
+	// frontend, so the lock mustn't be held
+	if v != nil {
+		t.currentWindow.SetActiveView(v)
+	}
+}
+
+// visibleViews returns the views currently shown on screen.
+// Must be called with t.lock held.
+func (t *tbfe) visibleViews() (vs []*backend.View) {
+	for _, g := range t.groups {
+		if g.active != nil {
+			vs = append(vs, g.active)
+		}
+	}
+	if *showConsole {
+		vs = append(vs, t.console)
+	}
+	if t.inputPanel != nil {
+		vs = append(vs, t.inputPanel.view)
+	}
+	return
+}
+
+// relayout recalculates the position of the groups and makes sure the
+// visible region of the views on screen fit their new size.
+func (t *tbfe) relayout() {
+	t.lock.Lock()
+	t.arrange()
+	vs := t.visibleViews()
+	t.lock.Unlock()
+
+	for _, v := range vs {
+		t.Show(v, t.VisibleRegion(v))
+	}
+	t.render()
+}
+
+func (t *tbfe) renderBorders() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for i, g := range t.groups {
+		fg := defaultFg
+		if i == t.activeGroup && len(t.groups) > 1 {
+			fg = selectionBorderBg
+		}
+		l := g.layout
+		if g.rightBorder {
+			for y := l.y; y < l.y+l.height; y++ {
+				scr.SetCell(l.x+l.width, y, '│', fg, defaultBg)
+			}
+		}
+		if g.bottomBorder {
+			for x := l.x; x < l.x+l.width; x++ {
+				scr.SetCell(x, l.y+l.height, '─', fg, defaultBg)
+			}
+		}
+		if g.rightBorder && g.bottomBorder {
+			scr.SetCell(l.x+l.width, l.y+l.height, '┼', fg, defaultBg)
+		}
+	}
+}
+
+func (c *SetLayoutCommand) Init(args backend.Args) (err error) {
+	c.layout, err = parseLayout(args)
+	return
+}
+
+func (c *SetLayoutCommand) Run(w *backend.Window) error {
+	t := frontend()
+	if t == nil {
+		return errNoFrontend
+	}
+	t.lock.Lock()
+	t.setLayout(c.layout)
+	t.lock.Unlock()
+	t.relayout()
+	return nil
+}
+
+func (c *FocusGroupCommand) Init(args backend.Args) error {
+	c.Group = intArg(args, "group", 0)
+	return nil
+}
+
+func (c *FocusGroupCommand) Run(w *backend.Window) error {
+	t := frontend()
+	if t == nil {
+		return errNoFrontend
+	}
+	t.focusGroup(c.Group)
+	t.render()
+	return nil
+}
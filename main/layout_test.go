@@ -0,0 +1,82 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/limetext/backend"
+)
+
+func TestParseLayout(t *testing.T) {
+	tests := []struct {
+		args backend.Args
+		fail bool
+	}{
+		{
+			backend.Args{
+				"cols":  []interface{}{0.0, 0.5, 1.0},
+				"rows":  []interface{}{0.0, 1.0},
+				"cells": []interface{}{[]interface{}{0.0, 0.0, 1.0, 1.0}, []interface{}{1.0, 0.0, 2.0, 1.0}},
+			},
+			false,
+		},
+		{
+			backend.Args{
+				"cols":  []interface{}{0.0, 1.0},
+				"rows":  []interface{}{0.0, 1.0},
+				"cells": []interface{}{[]interface{}{0.0, 0.0, 2.0, 1.0}},
+			},
+			true,
+		},
+		{
+			backend.Args{
+				"cols":  []interface{}{0.5, 0.2},
+				"rows":  []interface{}{0.0, 1.0},
+				"cells": []interface{}{[]interface{}{0.0, 0.0, 1.0, 1.0}},
+			},
+			true,
+		},
+		{
+			backend.Args{"cols": []interface{}{0.0, 1.0}},
+			true,
+		},
+	}
+
+	for i, test := range tests {
+		if _, err := parseLayout(test.args); (err != nil) != test.fail {
+			t.Errorf("Test %d: Expected failure %v, got error %v", i, test.fail, err)
+		}
+	}
+}
+
+func TestLayoutRects(t *testing.T) {
+	wl := windowLayout{
+		cols:  []float64{0, 0.5, 1},
+		rows:  []float64{0, 0.5, 1},
+		cells: [][4]int{{0, 0, 1, 2}, {1, 0, 2, 1}, {1, 1, 2, 2}},
+	}
+	exp := []layout{
+		{x: 0, y: 0, width: 39, height: 20},
+		{x: 40, y: 0, width: 40, height: 9},
+		{x: 40, y: 10, width: 40, height: 10},
+	}
+
+	gs := wl.rects(0, 0, 80, 20)
+	if len(gs) != len(exp) {
+		t.Fatalf("Expected %d rects, got %d", len(exp), len(gs))
+	}
+	for i, g := range gs {
+		if g.layout != exp[i] {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, exp[i], g.layout)
+		}
+	}
+	if !gs[0].rightBorder || gs[0].bottomBorder {
+		t.Errorf("Expected only a right border on the left group")
+	}
+	if gs[1].rightBorder || !gs[1].bottomBorder {
+		t.Errorf("Expected only a bottom border on the top right group")
+	}
+}
@@ -19,6 +19,7 @@ var (
 	showConsole   = flag.Bool("console", false, "Display console")
 	consoleHeight = flag.Int("consoleHeight", 20, "Height of console")
 	rotateLog     = flag.Bool("rotateLog", false, "Rotate debug log")
+	colorMode     = flag.String("colors", "auto", "Color mode: auto, truecolor, 256, 16 or 8")
 )
 
 func main() {
@@ -32,6 +33,8 @@ func main() {
 		log.Error(err)
 		return
 	}
+	termbox.SetInputMode(termbox.InputAlt | termbox.InputMouse)
+	enableKeyReporting()
 
 	defer shutdown()
 
@@ -46,6 +49,7 @@ func shutdown() {
 	py.NewLock()
 	py.Finalize()
 
+	disableKeyReporting()
 	termbox.Close()
 
 	log.Debug(util.Prof)
@@ -5,14 +5,29 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+	"unicode"
 
 	"github.com/limetext/backend"
+	"github.com/limetext/backend/keys"
+	"github.com/limetext/backend/render"
+	"github.com/limetext/loaders"
 	. "github.com/limetext/text"
+	"github.com/limetext/util"
 	"github.com/nsf/termbox-go"
 )
 
+func TestMain(m *testing.M) {
+	// The tests draw on a screen in memory instead of the terminal
+	scr = newMemScreen(100, 100)
+	os.Exit(m.Run())
+}
+
 func TestPadLineRunes(t *testing.T) {
 	var testPadData = []struct {
 		line     int
@@ -64,6 +79,91 @@ func TestGetCaretStyle(t *testing.T) {
 	}
 }
 
+func TestSelectionCursor(t *testing.T) {
+	sc := newSelectionCursor([]Region{{1, 1}, {3, 5}, {8, 6}})
+
+	tests := []struct {
+		offset   int
+		selected bool
+		border   bool
+		caret    bool
+	}{
+		{0, false, false, false},
+		{1, false, false, true},
+		{2, false, false, false},
+		{3, true, true, false},
+		{4, true, true, false},
+		{5, false, false, true},
+		{6, true, true, true},
+		{7, true, true, false},
+		{8, false, false, false},
+	}
+
+	for i, test := range tests {
+		selected, border := sc.at(test.offset)
+		if selected != test.selected || border != test.border {
+			t.Errorf("Test %d: Expected selected %v border %v, got %v %v", i, test.selected, test.border, selected, border)
+		}
+		if caret := sc.caret(test.offset); caret != test.caret {
+			t.Errorf("Test %d: Expected caret %v, got %v", i, test.caret, caret)
+		}
+	}
+}
+
+func TestFirstTab(t *testing.T) {
+	tests := []struct {
+		widths        []int
+		active, width int
+		exp           int
+	}{
+		{[]int{5, 5, 5}, 2, 20, 0},
+		{[]int{5, 5, 5}, 2, 10, 1},
+		{[]int{5, 5, 5}, 2, 4, 2},
+		{[]int{5, 5, 5}, 0, 4, 0},
+	}
+
+	for i, test := range tests {
+		if first := firstTab(test.widths, test.active, test.width); first != test.exp {
+			t.Errorf("Test %d: Expected %d, got %d", i, test.exp, first)
+		}
+	}
+}
+
+func TestWideTabs(t *testing.T) {
+	s := newMemScreen(12, 2)
+	old := scr
+	scr = s
+	defer func() { scr = old }()
+
+	w := backend.GetEditor().NewWindow()
+	defer w.Close()
+	v1, v2 := w.NewFile(), w.NewFile()
+	v1.SetScratch(true)
+	v2.SetScratch(true)
+	v1.SetName("日本")
+	v2.SetName("go")
+	g := &group{views: []*backend.View{v1, v2}, active: v1, layout: layout{width: 12, height: 2}}
+	fe := &tbfe{groups: []*group{g}}
+
+	// The first tab is 6 cells wide, so the second starts at x 6. Wide
+	// runes take up two cells, of which only the first is set
+	tests := []struct{ x, exp int }{{0, 0}, {5, 0}, {6, 1}, {9, 1}, {10, -1}}
+	for i, test := range tests {
+		if tab := g.tabAt(test.x); tab != test.exp {
+			t.Errorf("Test %d: Expected tab %d at %d, but got %d", i, test.exp, test.x, tab)
+		}
+	}
+
+	fe.renderTabs()
+	var row []rune
+	for _, c := range s.CellBuffer()[:12] {
+		row = append(row, c.Ch)
+	}
+	if exp := " 日 本   go   "; string(row) != exp {
+		t.Errorf("Expected %q, but got %q", exp, string(row))
+	}
+}
+
 func TestUpdateVisibleRegion(t *testing.T) {
 	var (
 		fe tbfe
@@ -73,7 +173,7 @@ func TestUpdateVisibleRegion(t *testing.T) {
 	)
 
 	fe.layout = make(map[*backend.View]layout)
-	fe.layout[v] = layout{0, 0, 100, 100 - *consoleHeight - 1, Region{}, 0}
+	fe.layout[v] = layout{width: 100, height: 100 - *consoleHeight - 1}
 	fe.setupCallbacks(v)
 
 	edit := v.BeginEdit()
@@ -155,14 +255,14 @@ func TestLoopShutdown(t *testing.T) {
 func TestHandleInput(t *testing.T) {
 	frontend := createFrontend()
 
-	event_a := termbox.Event{
+	event_a := inputEvent{Event: termbox.Event{
 		Type: termbox.EventKey,
 		Ch:   'a',
-	}
-	event_b := termbox.Event{
+	}}
+	event_b := inputEvent{Event: termbox.Event{
 		Type: termbox.EventKey,
 		Ch:   'b',
-	}
+	}}
 	expected := "ab"
 
 	frontend.handleInput(event_a)
@@ -176,3 +276,478 @@ func TestHandleInput(t *testing.T) {
 		t.Errorf("Expected %q to be in editor's view, but got %q.", expected, substring)
 	}
 }
+
+func TestFuzzyFilter(t *testing.T) {
+	items := []string{"Set Syntax: Go", "Save", "Close", "Select All"}
+	tests := []struct {
+		pattern string
+		exp     []int
+	}{
+		{"", []int{0, 1, 2, 3}},
+		{"sa", []int{3, 1, 0}},
+		{"clo", []int{2}},
+		{"xyz", nil},
+	}
+
+	for i, test := range tests {
+		ms := fuzzyFilter([]rune(test.pattern), items)
+		if len(ms) != len(test.exp) {
+			t.Errorf("Test %d: Expected %d matches, got %d", i, len(test.exp), len(ms))
+			continue
+		}
+		for j, m := range ms {
+			if m.index != test.exp[j] {
+				t.Errorf("Test %d: Expected match %d to be %d, got %d", i, j, test.exp[j], m.index)
+			}
+		}
+	}
+}
+
+func TestAllBindings(t *testing.T) {
+	var user, def keys.HasKeyBindings
+	if err := loaders.LoadJSON([]byte(`[{"keys": ["alt+s"], "command": "save_all"}]`), user.KeyBindings()); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaders.LoadJSON([]byte(`[{"keys": ["ctrl+s"], "command": "save"}, {"keys": ["ctrl+shift+s"], "command": "save_all"}]`), def.KeyBindings()); err != nil {
+		t.Fatal(err)
+	}
+	user.KeyBindings().SetParent(&def)
+
+	// The user's binding of save_all is found before the Default one
+	bindings := allBindings(user.KeyBindings())
+	if len(bindings) != 3 {
+		t.Fatalf("Expected the bindings of both levels, but got %v", bindings)
+	}
+	if chord := keyChord(bindings, "save_all", nil); chord != "alt+s" {
+		t.Errorf("Expected save_all to be bound to alt+s, but got %q", chord)
+	}
+	if chord := keyChord(bindings, "save", nil); chord != "ctrl+s" {
+		t.Errorf("Expected save to be bound to ctrl+s, but got %q", chord)
+	}
+}
+
+func TestKeyChord(t *testing.T) {
+	bindings := []*keys.KeyBinding{
+		{Keys: []keys.KeyPress{{Key: 'k', Ctrl: true}, {Key: 'b', Ctrl: true}}, Command: "toggle_side_bar"},
+		{Keys: []keys.KeyPress{{Key: '1', Alt: true}}, Command: "select_by_index", Args: map[string]interface{}{"index": 0.0}},
+		{Keys: []keys.KeyPress{{Key: '2', Alt: true}}, Command: "select_by_index", Args: map[string]interface{}{"index": 1.0}},
+	}
+	tests := []struct {
+		cmd  string
+		args backend.Args
+		exp  string
+	}{
+		{"toggle_side_bar", nil, "ctrl+k ctrl+b"},
+		{"select_by_index", backend.Args{"index": 1.0}, "alt+2"},
+		{"select_by_index", nil, ""},
+		{"save", nil, ""},
+	}
+
+	for i, test := range tests {
+		if chord := keyChord(bindings, test.cmd, test.args); chord != test.exp {
+			t.Errorf("Test %d: Expected %q, got %q", i, test.exp, chord)
+		}
+	}
+}
+
+func TestPasteKey(t *testing.T) {
+	// The editor only inserts the text of key presses of characters
+	if kp := (keys.KeyPress{Key: pasteKey}); !kp.IsCharacter() {
+		t.Errorf("Expected %v to be a character", kp)
+	}
+}
+
+func TestInputPanelBindings(t *testing.T) {
+	tests := []struct {
+		key  keys.Key
+		done bool
+	}{
+		{inputPanelEnter, true},
+		{inputPanelEscape, false},
+	}
+
+	for i, test := range tests {
+		bs := frontendKeyBindings.KeyBindings().Filter(keys.KeyPress{Key: test.key})
+		if len(bs.Bindings) != 1 || bs.Bindings[0].Command != "hide_input_panel" {
+			t.Errorf("Test %d: Expected the key to be bound to hide_input_panel, but got %v", i, bs.Bindings)
+			continue
+		}
+		if done := bs.Bindings[0].Args["done"]; done != test.done {
+			t.Errorf("Test %d: Expected done to be %v, but got %v", i, test.done, done)
+		}
+	}
+}
+
+func TestAskCancelsOverlay(t *testing.T) {
+	fe := &tbfe{
+		dorender:  make(chan bool, render_chan_len),
+		layout:    make(map[*backend.View]layout),
+		groups:    []*group{{}},
+		winLayout: singleLayout,
+	}
+	overlay := func() overlay {
+		fe.lock.Lock()
+		defer fe.lock.Unlock()
+		return fe.overlay
+	}
+
+	first := make(chan int)
+	go func() {
+		first <- fe.ask("first", []string{"Ok", "Cancel"}, 1)
+	}()
+	for overlay() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	second := make(chan int)
+	go func() {
+		second <- fe.ask("second", []string{"Ok"}, 0)
+	}()
+
+	select {
+	case i := <-first:
+		if i != 1 {
+			t.Errorf("Expected the first dialog to be cancelled, but got %d", i)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the first dialog to be done when the second was shown")
+	}
+	overlay().handleInput(keys.KeyPress{Key: keys.Enter})
+	if i := <-second; i != 0 {
+		t.Errorf("Expected the second dialog to be answered, but got %d", i)
+	}
+}
+
+func TestQuickPanelDoneAsks(t *testing.T) {
+	fe := &tbfe{
+		dorender:  make(chan bool, render_chan_len),
+		layout:    make(map[*backend.View]layout),
+		groups:    []*group{{}},
+		winLayout: singleLayout,
+	}
+	overlay := func() overlay {
+		fe.lock.Lock()
+		defer fe.lock.Unlock()
+		return fe.overlay
+	}
+
+	answer := make(chan int)
+	fe.ShowQuickPanel([][]string{{"foo"}}, 0, func(i int) {
+		answer <- fe.ask("sure?", []string{"Ok"}, 0)
+	}, nil)
+	// Picking the item mustn't wait for the dialog it opens to be answered
+	picked := make(chan bool)
+	go func() {
+		overlay().handleInput(keys.KeyPress{Key: keys.Enter})
+		picked <- true
+	}()
+	select {
+	case <-picked:
+	case <-time.After(time.Second):
+		t.Fatal("Expected picking an item not to block on the dialog")
+	}
+
+	for {
+		if _, ok := overlay().(*dialog); ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	overlay().handleInput(keys.KeyPress{Key: keys.Enter})
+	if i := <-answer; i != 0 {
+		t.Errorf("Expected the dialog to be answered, but got %d", i)
+	}
+}
+
+func TestPaletteCache(t *testing.T) {
+	pc := paletteCache{cmds: make(map[string][]paletteCommand)}
+	pc.add("testdata/palette")
+	cmds := pc.commands()
+	if len(cmds) != 2 || cmds[0].Command != "foo_bar" || cmds[1].Command != "foo_baz" {
+		t.Errorf("Expected the commands foo_bar and foo_baz, but got %v", cmds)
+	}
+	pc.remove("testdata/palette")
+	if cmds := pc.commands(); len(cmds) != 0 {
+		t.Errorf("Expected no commands after removing the path, but got %v", cmds)
+	}
+}
+
+func TestQuickPanelHint(t *testing.T) {
+	s := newMemScreen(24, 8)
+	old := scr
+	scr = s
+	defer func() { scr = old }()
+
+	qp := newQuickPanel(nil, [][]string{{"A caption longer than the panel"}}, nil, nil)
+	qp.hints = []string{"ctrl+x"}
+	qp.render(24, 8)
+
+	// The panel is 20 cells wide, from x 2
+	var row []rune
+	for _, c := range s.CellBuffer()[24*2+2 : 24*2+22] {
+		row = append(row, c.Ch)
+	}
+	if exp := " A caption l ctrl+x "; string(row) != exp {
+		t.Errorf("Expected %q, but got %q", exp, string(row))
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		exp   []string
+	}{
+		{"short", 10, []string{"short"}},
+		{"save changes to foo.go?", 12, []string{"save changes", "to foo.go?"}},
+		{"abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"one\ntwo", 10, []string{"one", "two"}},
+	}
+
+	for i, test := range tests {
+		lines := wrapText(test.text, test.width)
+		if !reflect.DeepEqual(lines, test.exp) {
+			t.Errorf("Test %d: Expected %q, got %q", i, test.exp, lines)
+		}
+	}
+}
+
+func TestColToOffset(t *testing.T) {
+	line := []rune("\tab\tc")
+	tests := []struct {
+		col, exp int
+	}{
+		{0, 0},
+		{3, 0},
+		{4, 1},
+		{5, 2},
+		{6, 3},
+		{7, 3},
+		{8, 4},
+		{20, 5},
+	}
+
+	for i, test := range tests {
+		if o := colToOffset(line, test.col, 4); o != test.exp {
+			t.Errorf("Test %d: Expected %d, got %d", i, test.exp, o)
+		}
+	}
+
+	// A wide rune followed by an e with a combining acute accent
+	line = []rune("日e\u0301x")
+	tests = []struct {
+		col, exp int
+	}{
+		{0, 0},
+		{1, 0},
+		{2, 1},
+		{3, 3},
+		{4, 4},
+	}
+
+	for i, test := range tests {
+		if o := colToOffset(line, test.col, 4); o != test.exp {
+			t.Errorf("Wide test %d: Expected %d, got %d", i, test.exp, o)
+		}
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	tests := []struct {
+		text string
+		exp  int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"\tab", 6},
+		{"a\tb", 5},
+		{"日本語", 6},
+		{"e\u0301", 1},
+		{"日\t", 4},
+	}
+
+	for i, test := range tests {
+		if w := textWidth([]rune(test.text), 4); w != test.exp {
+			t.Errorf("Test %d: Expected %d, got %d", i, test.exp, w)
+		}
+	}
+}
+
+func TestCluster(t *testing.T) {
+	tests := []struct {
+		text string
+		i    int
+		exp  rune
+		n    int
+	}{
+		{"ab", 0, 'a', 1},
+		{"e\u0301x", 0, 'é', 2},
+		{"xe\u0301", 1, 'é', 2},
+		// No precomposed rune, so the marks are left out
+		{"q\u0301\u0323", 0, 'q', 3},
+		{"e\t", 0, 'e', 1},
+	}
+
+	for i, test := range tests {
+		if r, n := cluster([]rune(test.text), test.i); r != test.exp || n != test.n {
+			t.Errorf("Test %d: Expected %q, %d, but got %q, %d", i, test.exp, test.n, r, n)
+		}
+	}
+}
+
+func TestRenderCombining(t *testing.T) {
+	s := newMemScreen(10, 1)
+	old := scr
+	scr = s
+	defer func() { scr = old }()
+
+	w := backend.GetEditor().NewWindow()
+	defer w.Close()
+	v := w.NewFile()
+	defer func() {
+		v.SetScratch(true)
+		v.Close()
+	}()
+	e := v.BeginEdit()
+	v.Insert(e, 0, "e\u0301x")
+	v.EndEdit(e)
+	v.Settings().Set("line_numbers", false)
+
+	tests := []struct {
+		sel    Region
+		fg, bg termbox.Attribute
+	}{
+		// The caret on the accent is shown on the e it's drawn with
+		{Region{A: 1, B: 1}, defaultFg | termbox.AttrUnderline, defaultBg},
+		{Region{A: 1, B: 2}, defaultFg, selectionBorderBg},
+		{Region{A: 2, B: 2}, defaultFg, defaultBg},
+	}
+
+	for i, test := range tests {
+		lr := newLineRenderer(backend.GetEditor(), v, layout{width: 10, height: 1, visible: Region{A: 0, B: v.Size()}})
+		lr.caretStyle = termbox.AttrUnderline
+		lr.rc = newRecipeCursor(nil)
+		lr.sc, lr.hc = newSelectionCursor([]Region{test.sel}), newSelectionCursor(nil)
+		lr.renderLine(viewLine{region: Region{A: 0, B: 3}, text: "e\u0301x", n: 1})
+
+		cells := s.CellBuffer()
+		if c := cells[0]; c.Ch != 'é' || c.Fg != test.fg || c.Bg != test.bg {
+			t.Errorf("Test %d: Expected é with %v, %v, but got %q with %v, %v", i, test.fg, test.bg, c.Ch, c.Fg, c.Bg)
+		}
+		if c := cells[1]; c.Ch != 'x' {
+			t.Errorf("Test %d: Expected x after é, but got %q", i, c.Ch)
+		}
+	}
+}
+
+func BenchmarkLineColours(b *testing.B) {
+	data, err := ioutil.ReadFile("frontend.go")
+	if err != nil {
+		b.Fatal(err)
+	}
+	text := []rune(strings.Repeat(string(data), 10))
+
+	// A span for every word, like a heavily highlighted file has
+	fs := []render.Flavour{
+		{Foreground: render.Colour{R: 140, A: 255}, Background: render.Colour{A: 255}},
+		{Foreground: render.Colour{B: 140, A: 255}, Background: render.Colour{A: 255}},
+	}
+	var recipe render.TranscribedRecipe
+	start := -1
+	for i, r := range text {
+		if !unicode.IsSpace(r) {
+			if start == -1 {
+				start = i
+			}
+			continue
+		}
+		if start != -1 {
+			recipe = append(recipe, render.RenderUnit{Flavour: fs[len(recipe)%2], Region: Region{A: start, B: i}})
+			start = -1
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lr := &lineRenderer{
+			rc: newRecipeCursor(recipe),
+			sc: newSelectionCursor(nil),
+			hc: newSelectionCursor(nil),
+		}
+		for o := range text {
+			lr.colours(o)
+		}
+	}
+}
+
+// BenchmarkRenderViewFull renders a screenful of a view from scratch, as
+// it was before the cells of unchanged lines were cached.
+func BenchmarkRenderViewFull(b *testing.B) {
+	benchmarkRenderView(b, false)
+}
+
+// BenchmarkRenderViewCached renders a screenful of a view with its lines
+// copied from the cache.
+func BenchmarkRenderViewCached(b *testing.B) {
+	benchmarkRenderView(b, true)
+}
+
+// benchmarkRenderView renders a view of this package's frontend.go, and
+// logs the time spent in each part of rendering as measured by util.Prof.
+func benchmarkRenderView(b *testing.B, cached bool) {
+	data, err := ioutil.ReadFile("frontend.go")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	s := newMemScreen(100, 50)
+	old := scr
+	scr = s
+	defer func() { scr = old }()
+
+	ed := backend.GetEditor()
+	w := ed.NewWindow()
+	defer w.Close()
+	v := w.NewFile()
+	defer func() {
+		v.SetScratch(true)
+		v.Close()
+	}()
+	e := v.BeginEdit()
+	v.Insert(e, 0, string(data))
+	v.EndEdit(e)
+
+	fe := &tbfe{
+		layout:     make(map[*backend.View]layout),
+		highlights: make(map[*backend.View][]Region),
+		caches:     make(map[*backend.View]*viewCache),
+		editor:     ed,
+	}
+	fe.layout[v] = layout{width: 100, height: 50}
+	fe.Show(v, Region{})
+	fe.renderView(v, fe.layout[v])
+
+	before := profile()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !cached {
+			fe.invalidate(v)
+		}
+		fe.renderView(v, fe.layout[v])
+	}
+	b.StopTimer()
+	after := profile()
+	for _, name := range []string{"render", "view.Transform", "render.line", "render.copy"} {
+		calls := after[name].Calls - before[name].Calls
+		total := after[name].Tottime - before[name].Tottime
+		b.Logf("%-15s %6d calls, %12v per render", name, calls, total/time.Duration(b.N))
+	}
+}
+
+// profile returns what util.Prof has measured so far by name.
+func profile() map[string]util.ProfileEntry {
+	m := make(map[string]util.ProfileEntry)
+	for _, r := range util.Prof.Results() {
+		m[r.Name] = r.ProfileEntry
+	}
+	return m
+}
@@ -0,0 +1,199 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strconv"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/log"
+	. "github.com/limetext/text"
+	"github.com/nsf/termbox-go"
+)
+
+type (
+	// mouseState tracks a drag in progress. It's only touched from the
+	// main loop, so it isn't protected by the frontend's lock.
+	mouseState struct {
+		dragging bool
+		view     *backend.View
+		anchor   int
+		// base is the selection the dragged region is added to, which
+		// is empty unless the drag started with an alt-click.
+		base []Region
+	}
+
+	// MouseSelectCommand replaces the selection with the regions a click
+	// or drag selected. Going through a command keeps the selection
+	// changes inside an edit like every other change the editor makes.
+	MouseSelectCommand struct {
+		backend.BypassUndoCommand
+		Regions []Region
+	}
+)
+
+const wheelLines = 3
+
+// pointAt returns the text point of v drawn at the screen cell x, y when
+// v is laid out as l.
+func pointAt(v *backend.View, l layout, x, y int) int {
+	if wc, ok := viewWrap(v, l); ok {
+		return wc.pointAt(v, l.visible, y-l.y, x-l.x-gutterWidth(v))
+	}
+	row, _ := v.RowCol(l.visible.Begin())
+	row += y - l.y
+	if last, _ := v.RowCol(v.Size()); row > last {
+		return v.Size()
+	}
+	line := v.Line(v.TextPoint(row, 0))
+	col := x - l.x - gutterWidth(v)
+	if col < 0 {
+		col = 0
+	}
+	col += l.scroll
+	return line.Begin() + colToOffset([]rune(v.Substr(line)), col, viewTabSize(v))
+}
+
+// scrollView scrolls the visible region of v by the given number of lines,
+// or of rows if they are wrapped, without moving the selection.
+func (t *tbfe) scrollView(v *backend.View, lines int) {
+	t.lock.Lock()
+	l := t.layout[v]
+	t.lock.Unlock()
+
+	var r Region
+	if wc, ok := viewWrap(v, l); ok {
+		// Wrapped lines are scrolled through a row at a time
+		s, _ := wc.scroll(v, l.visible.Begin(), lines)
+		r = wc.clip(v, s, l.height)
+	} else {
+		row, _ := v.RowCol(l.visible.Begin())
+		row += lines
+		if last, _ := v.RowCol(v.Size()); row > last {
+			row = last
+		}
+		if row < 0 {
+			row = 0
+		}
+		r = t.clip(v, row, row+l.height)
+	}
+
+	t.lock.Lock()
+	l = t.layout[v]
+	l.visible = r
+	t.layout[v] = l
+	t.lock.Unlock()
+	t.render()
+}
+
+func (t *tbfe) handleMouse(ev termbox.Event) {
+	x, y := ev.MouseX, ev.MouseY
+	if ev.Key == termbox.MouseRelease {
+		t.mouse.dragging = false
+		return
+	}
+
+	t.lock.Lock()
+	if t.overlay != nil {
+		t.lock.Unlock()
+		return
+	}
+	statusY := t.window_layout.height - statusbarHeight
+	var (
+		view  *backend.View
+		vl    layout
+		group = -1
+		tab   = -1
+	)
+	for i, g := range t.groups {
+		if l := g.layout; y == l.y && x >= l.x && x < l.x+l.width {
+			group, tab = i, g.tabAt(x)
+		}
+	}
+	for _, v := range t.visibleViews() {
+		if l := t.layout[v]; x >= l.x && x < l.x+l.width && y >= l.y && y < l.y+l.height {
+			view, vl = v, l
+		}
+	}
+	if view != nil {
+		group = t.groupOf(view)
+	}
+	t.lock.Unlock()
+
+	switch {
+	case ev.Key != termbox.MouseLeft && ev.Key != termbox.MouseWheelUp && ev.Key != termbox.MouseWheelDown:
+		return
+	case y == statusY:
+		if ev.Key == termbox.MouseLeft {
+			t.clickStatusBar(x)
+		}
+	case tab != -1:
+		if ev.Key == termbox.MouseLeft {
+			t.focusGroup(group)
+			t.selectView(tab, false)
+		}
+	case view == nil:
+	case ev.Key == termbox.MouseWheelUp:
+		t.scrollView(view, -wheelLines)
+	case ev.Key == termbox.MouseWheelDown:
+		t.scrollView(view, wheelLines)
+	default:
+		t.clickView(view, group, pointAt(view, vl, x, y), ev.Mod&termbox.ModAlt != 0)
+	}
+}
+
+func (c *MouseSelectCommand) Run(v *backend.View, e *backend.Edit) error {
+	sel := v.Sel()
+	sel.Clear()
+	sel.AddAll(c.Regions)
+	return nil
+}
+
+// clickView places the caret at point p of v, or extends the selection
+// to it while dragging. If add is set a caret is added to the existing
+// selection instead. Terminals don't report ctrl with mouse clicks, so
+// that's done with alt-click rather than the ctrl-click sublime uses.
+func (t *tbfe) clickView(v *backend.View, group, p int, add bool) {
+	m := &t.mouse
+	if !m.dragging || m.view != v {
+		if group != -1 {
+			t.focusGroup(group)
+		}
+		m.dragging, m.view, m.anchor, m.base = true, v, p, nil
+		if add {
+			m.base = v.Sel().Regions()
+		}
+	}
+	rs := append(append([]Region(nil), m.base...), Region{m.anchor, p})
+	if err := t.editor.CommandHandler().RunTextCommand(v, "mouse_select", backend.Args{"regions": rs}); err != nil {
+		log.Error("Couldn't set the selection: %s", err)
+	}
+	t.render()
+}
+
+// clickStatusBar handles clicks on the status bar. Clicking the tab size
+// lets the user pick another one.
+func (t *tbfe) clickStatusBar(x int) {
+	t.lock.Lock()
+	v, w := t.currentView, t.window_layout.width
+	t.lock.Unlock()
+	if v == nil {
+		return
+	}
+
+	tabSize := viewTabSize(v)
+	if x < w-1-stringWidth(statusRight(tabSize)) {
+		return
+	}
+	items := make([][]string, 8)
+	for i := range items {
+		items[i] = []string{"Tab Width: " + strconv.Itoa(i+1)}
+	}
+	t.ShowQuickPanel(items, tabSize-1, func(i int) {
+		if i >= 0 {
+			v.Settings().Set("tab_size", i+1)
+		}
+	}, nil)
+}
@@ -0,0 +1,95 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/limetext/backend"
+	. "github.com/limetext/text"
+	"github.com/nsf/termbox-go"
+)
+
+func TestPointAt(t *testing.T) {
+	w := backend.GetEditor().NewWindow()
+	defer w.Close()
+	v := w.NewFile()
+	defer func() {
+		v.SetScratch(true)
+		v.Close()
+	}()
+	e := v.BeginEdit()
+	v.Insert(e, 0, "foo\nbar")
+	v.EndEdit(e)
+
+	l := layout{x: 10, y: 2, width: 20, height: 5, visible: Region{0, v.Size()}}
+	tests := []struct {
+		lineNumbers bool
+		x, y        int
+		exp         int
+	}{
+		// With line numbers the text starts after a gutter of 2 cells
+		{true, 13, 3, 5},
+		{true, 10, 3, 4},
+		{true, 12, 2, 0},
+		{true, 20, 2, 3},
+		{false, 11, 3, 5},
+		{false, 10, 2, 0},
+		{false, 10, 4, 7},
+	}
+
+	for i, test := range tests {
+		v.Settings().Set("line_numbers", test.lineNumbers)
+		if p := pointAt(v, l, test.x, test.y); p != test.exp {
+			t.Errorf("Test %d: Expected %d, but got %d", i, test.exp, p)
+		}
+	}
+}
+
+func TestMouseDrag(t *testing.T) {
+	fe := &tbfe{
+		editor:   backend.GetEditor(),
+		dorender: make(chan bool, render_chan_len),
+		layout:   make(map[*backend.View]layout),
+	}
+	w := fe.editor.NewWindow()
+	defer w.Close()
+	v := w.NewFile()
+	defer func() {
+		v.SetScratch(true)
+		v.Close()
+	}()
+	e := v.BeginEdit()
+	v.Insert(e, 0, "foo bar baz")
+	v.EndEdit(e)
+	v.Sel().Clear()
+	v.Sel().Add(Region{0, 3})
+
+	tests := []struct {
+		p   int
+		add bool
+		exp []Region
+	}{
+		{8, true, []Region{{0, 3}, {8, 8}}},
+		{10, false, []Region{{0, 3}, {8, 10}}},
+		// Dragging back past the anchor only changes the dragged region
+		{5, false, []Region{{0, 3}, {8, 5}}},
+		{9, false, []Region{{0, 3}, {8, 9}}},
+	}
+
+	for i, test := range tests {
+		fe.clickView(v, -1, test.p, test.add)
+		if rs := v.Sel().Regions(); !reflect.DeepEqual(rs, test.exp) {
+			t.Errorf("Test %d: Expected %v, but got %v", i, test.exp, rs)
+		}
+	}
+
+	fe.handleMouse(termbox.Event{Type: termbox.EventMouse, Key: termbox.MouseRelease})
+	fe.clickView(v, -1, 4, false)
+	if rs, exp := v.Sel().Regions(), []Region{{4, 4}}; !reflect.DeepEqual(rs, exp) {
+		t.Errorf("Expected a click to replace the selection with %v, but got %v", exp, rs)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"unicode"
+
+	"github.com/limetext/backend/keys"
+	"github.com/limetext/backend/render"
+)
+
+type (
+	// overlay is a modal element drawn on top of the views. While an
+	// overlay is shown, all key input goes to it instead of the editor.
+	overlay interface {
+		// render draws the overlay on a screen of the given size.
+		render(w, h int)
+		handleInput(kp keys.KeyPress)
+		// cancel closes the overlay as if escape was pressed.
+		cancel()
+	}
+
+	// dockedOverlay is an overlay that takes up the given number of
+	// rows above the status bar, instead of covering up the views.
+	dockedOverlay interface {
+		overlay
+		height() int
+	}
+
+	// fuzzyMatch is an item matching the filter of a list overlay.
+	fuzzyMatch struct {
+		index     int
+		score     int
+		positions []int
+	}
+)
+
+var (
+	overlayColour = render.Colour{28, 29, 26, 1}
+	overlayBg     = color256(overlayColour)
+)
+
+// showOverlay shows o in place of the overlay shown already, if any,
+// which is cancelled. Overlays call back whoever showed them off the
+// main loop, so cancelling one here doesn't block either.
+func (t *tbfe) showOverlay(o overlay) {
+	t.lock.Lock()
+	old := t.overlay
+	t.overlay = o
+	t.lock.Unlock()
+	// Whoever showed the old overlay is waiting for it to be done with
+	if old != nil && old != o {
+		old.cancel()
+	}
+	t.relayout()
+}
+
+// hideOverlay closes o if it's the overlay currently shown.
+func (t *tbfe) hideOverlay(o overlay) {
+	t.lock.Lock()
+	if t.overlay == o {
+		t.overlay = nil
+	}
+	t.lock.Unlock()
+	scr.HideCursor()
+	t.relayout()
+}
+
+func (t *tbfe) renderOverlay() {
+	t.lock.Lock()
+	o := t.overlay
+	wl := t.window_layout
+	t.lock.Unlock()
+
+	if o != nil {
+		o.render(wl.width, wl.height)
+	}
+}
+
+// fuzzyScore reports whether all runes of pattern appear in s in order,
+// ignoring case, and if so how well they match. Runs of consecutive
+// runes and runes at the start of words score higher. The positions in
+// s of the matched runes are returned too.
+func fuzzyScore(pattern, s []rune) (score int, positions []int, ok bool) {
+	if len(pattern) == 0 {
+		return 0, nil, true
+	}
+	pi := 0
+	prev := -2
+	for i, r := range s {
+		if pi == len(pattern) {
+			break
+		}
+		if unicode.ToLower(r) != unicode.ToLower(pattern[pi]) {
+			continue
+		}
+		score++
+		if i == prev+1 {
+			score += 2
+		}
+		if i == 0 || !unicode.IsLetter(s[i-1]) || (unicode.IsUpper(r) && unicode.IsLower(s[i-1])) {
+			score += 3
+		}
+		positions = append(positions, i)
+		prev = i
+		pi++
+	}
+	if pi != len(pattern) {
+		return 0, nil, false
+	}
+	return score, positions, true
+}
+
+// fuzzyFilter returns the items matching pattern, best matches first.
+// Items with equal scores keep their original order.
+func fuzzyFilter(pattern []rune, items []string) []fuzzyMatch {
+	var ms []fuzzyMatch
+	for i, it := range items {
+		if score, pos, ok := fuzzyScore(pattern, []rune(it)); ok {
+			ms = append(ms, fuzzyMatch{i, score, pos})
+		}
+	}
+	sort.Stable(byScore(ms))
+	return ms
+}
+
+type byScore []fuzzyMatch
+
+func (b byScore) Len() int           { return len(b) }
+func (b byScore) Less(i, j int) bool { return b[i].score > b[j].score }
+func (b byScore) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
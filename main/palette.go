@@ -0,0 +1,187 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/keys"
+	"github.com/limetext/backend/log"
+	"github.com/limetext/loaders"
+)
+
+type (
+	// paletteCommand is an entry of a .sublime-commands file.
+	paletteCommand struct {
+		Caption string
+		Command string
+		Args    backend.Args
+	}
+
+	// paletteCache holds the commands of each packages path the editor
+	// has, loaded when the path is added so that opening the palette
+	// doesn't have to walk the packages.
+	paletteCache struct {
+		lock  sync.Mutex
+		paths []string
+		cmds  map[string][]paletteCommand
+	}
+
+	ShowOverlayCommand struct {
+		backend.DefaultCommand
+		Overlay string
+	}
+)
+
+var paletteCommands = paletteCache{cmds: make(map[string][]paletteCommand)}
+
+// loadPaletteCommands reads the commands of all the .sublime-commands
+// files found in the packages under path.
+func loadPaletteCommands(path string) (cmds []paletteCommand) {
+	var files []string
+	filepath.Walk(path, func(fn string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() && filepath.Ext(fn) == ".sublime-commands" {
+			files = append(files, fn)
+		}
+		return nil
+	})
+	sort.Strings(files)
+
+	for _, fn := range files {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			log.Warn("Couldn't read %s: %s", fn, err)
+			continue
+		}
+		var cs []paletteCommand
+		if err := loaders.LoadJSON(data, &cs); err != nil {
+			log.Warn("Couldn't load %s: %s", fn, err)
+			continue
+		}
+		for _, c := range cs {
+			if c.Caption != "" && c.Command != "" {
+				cmds = append(cmds, c)
+			}
+		}
+	}
+	return
+}
+
+func (pc *paletteCache) add(path string) {
+	cmds := loadPaletteCommands(path)
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+	if _, ok := pc.cmds[path]; !ok {
+		pc.paths = append(pc.paths, path)
+	}
+	pc.cmds[path] = cmds
+}
+
+func (pc *paletteCache) remove(path string) {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+	for i, p := range pc.paths {
+		if p == path {
+			pc.paths = append(pc.paths[:i], pc.paths[i+1:]...)
+			break
+		}
+	}
+	delete(pc.cmds, path)
+}
+
+// commands returns the commands of all the packages paths, in the order
+// the paths were added.
+func (pc *paletteCache) commands() (cmds []paletteCommand) {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+	for _, p := range pc.paths {
+		cmds = append(cmds, pc.cmds[p]...)
+	}
+	return
+}
+
+// allBindings returns the bindings of kb and of its parents, in the order
+// of their precedence: the user's come before the Default package's, and
+// those before the frontend's.
+func allBindings(kb *keys.KeyBindings) (bindings []*keys.KeyBinding) {
+	for kb != nil {
+		bindings = append(bindings, kb.Bindings...)
+		p := kb.Parent()
+		if p == nil {
+			break
+		}
+		kb = p.KeyBindings()
+	}
+	return
+}
+
+// keyChord returns the key sequence of the first of bindings that runs
+// cmd with args, or an empty string if there is none.
+func keyChord(bindings []*keys.KeyBinding, cmd string, args backend.Args) string {
+	for _, b := range bindings {
+		if b.Command != cmd {
+			continue
+		}
+		if len(b.Args) != len(args) || (len(args) > 0 && !reflect.DeepEqual(map[string]interface{}(args), b.Args)) {
+			continue
+		}
+		ks := make([]string, len(b.Keys))
+		for i, k := range b.Keys {
+			ks[i] = k.String()
+		}
+		return strings.Join(ks, " ")
+	}
+	return ""
+}
+
+// showCommandPalette shows a quick panel with the commands of the loaded
+// packages, and runs the one picked.
+func (t *tbfe) showCommandPalette() {
+	cmds := paletteCommands.commands()
+
+	bindings := allBindings(t.editor.KeyBindings())
+
+	items := make([][]string, len(cmds))
+	hints := make([]string, len(cmds))
+	for i, c := range cmds {
+		items[i] = []string{c.Caption}
+		hints[i] = keyChord(bindings, c.Command, c.Args)
+	}
+
+	qp := newQuickPanel(t, items, func(i int) {
+		if i < 0 {
+			return
+		}
+		t.editor.RunCommand(cmds[i].Command, cmds[i].Args)
+	}, nil)
+	qp.hints = hints
+	t.showQuickPanel(qp, 0)
+}
+
+func (c *ShowOverlayCommand) Run(w *backend.Window) error {
+	t := frontend()
+	if t == nil {
+		return errNoFrontend
+	}
+	switch c.Overlay {
+	case "command_palette":
+		t.showCommandPalette()
+	default:
+		log.Warn("Unsupported overlay: %s", c.Overlay)
+	}
+	return nil
+}
+
+func init() {
+	backend.OnPackagesPathAdd.Add(paletteCommands.add)
+	backend.OnPackagesPathRemove.Add(paletteCommands.remove)
+}
@@ -0,0 +1,375 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/keys"
+	"github.com/nsf/termbox-go"
+)
+
+type (
+	// fileBrowser is the overlay behind Prompt. It lists the entries of
+	// a directory, narrowed down by the name typed so far.
+	fileBrowser struct {
+		t        *tbfe
+		lock     sync.Mutex
+		title    string
+		flags    int
+		dir      string
+		input    []rune
+		hidden   bool
+		entries  []fileEntry
+		matches  []fileEntry
+		marked   map[string]bool
+		selected int
+		scroll   int
+		err      error
+		result   chan []string
+	}
+
+	fileEntry struct {
+		name string
+		dir  bool
+	}
+)
+
+const currentDirEntry = "."
+
+// Prompt asks the user for files or a folder to open or save to, starting
+// in folder, and blocks until they're chosen. It returns nil when the
+// prompt is cancelled. Like ask, this must not be called from the main
+// loop.
+func (t *tbfe) Prompt(title, folder string, flags int) []string {
+	if folder == "" {
+		folder, _ = os.Getwd()
+	}
+	fb := &fileBrowser{
+		t:      t,
+		title:  title,
+		flags:  flags,
+		marked: make(map[string]bool),
+		result: make(chan []string, 1),
+	}
+	fb.chdir(folder)
+	t.showOverlay(fb)
+	return <-fb.result
+}
+
+// readDir lists the entries of dir sorted by name with directories
+// first. Dot files are left out unless hidden is set, and files are left
+// out if onlyDirs is set.
+func readDir(dir string, hidden, onlyDirs bool) ([]fileEntry, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var es []fileEntry
+	for _, fi := range fis {
+		if !hidden && strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		if onlyDirs && !fi.IsDir() {
+			continue
+		}
+		es = append(es, fileEntry{fi.Name(), fi.IsDir()})
+	}
+	sort.Sort(byDirAndName(es))
+	return es, nil
+}
+
+type byDirAndName []fileEntry
+
+func (b byDirAndName) Len() int      { return len(b) }
+func (b byDirAndName) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byDirAndName) Less(i, j int) bool {
+	if b[i].dir != b[j].dir {
+		return b[i].dir
+	}
+	return b[i].name < b[j].name
+}
+
+// commonPrefix returns the longest prefix shared by all names.
+func commonPrefix(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	prefix := []rune(names[0])
+	for _, n := range names[1:] {
+		rs := []rune(n)
+		i := 0
+		for i < len(prefix) && i < len(rs) && prefix[i] == rs[i] {
+			i++
+		}
+		prefix = prefix[:i]
+	}
+	return string(prefix)
+}
+
+// chdir makes dir the directory being browsed.
+// Must be called with fb.lock held.
+func (fb *fileBrowser) chdir(dir string) {
+	fb.dir = filepath.Clean(dir)
+	fb.input = fb.input[:0]
+	fb.reload()
+}
+
+// reload rereads the directory being browsed.
+// Must be called with fb.lock held.
+func (fb *fileBrowser) reload() {
+	fb.entries, fb.err = readDir(fb.dir, fb.hidden, fb.flags&backend.PROMPT_ONLY_FOLDER != 0)
+	if fb.dir != filepath.Dir(fb.dir) {
+		fb.entries = append([]fileEntry{{"..", true}}, fb.entries...)
+	}
+	if fb.flags&backend.PROMPT_ONLY_FOLDER != 0 {
+		fb.entries = append([]fileEntry{{currentDirEntry, true}}, fb.entries...)
+	}
+	fb.refilter()
+}
+
+// refilter updates the entries matching the input.
+// Must be called with fb.lock held.
+func (fb *fileBrowser) refilter() {
+	fb.matches = fb.matches[:0]
+	for _, e := range fb.entries {
+		if strings.HasPrefix(e.name, string(fb.input)) {
+			fb.matches = append(fb.matches, e)
+		}
+	}
+	fb.selected, fb.scroll = 0, 0
+}
+
+// complete extends the input to the longest prefix shared by the matching
+// entries, and enters the directory if it is the only match.
+// Must be called with fb.lock held.
+func (fb *fileBrowser) complete() {
+	if len(fb.matches) == 1 && fb.matches[0].dir && fb.matches[0].name != currentDirEntry {
+		fb.chdir(filepath.Join(fb.dir, fb.matches[0].name))
+		return
+	}
+	names := make([]string, len(fb.matches))
+	for i, e := range fb.matches {
+		names[i] = e.name
+	}
+	if p := commonPrefix(names); len(p) > len(string(fb.input)) {
+		fb.input = []rune(p)
+		fb.refilter()
+	}
+}
+
+// path returns the path name refers to. Names are relative to the
+// directory being browsed, unless they're absolute or start with ~, which
+// stands for the home directory.
+// Must be called with fb.lock held.
+func (fb *fileBrowser) path(name string) string {
+	if home := os.Getenv("HOME"); home != "" {
+		if name == "~" || strings.HasPrefix(name, "~"+string(filepath.Separator)) {
+			name = filepath.Join(home, name[1:])
+		}
+	}
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+	return filepath.Join(fb.dir, name)
+}
+
+// typed handles the input changing. Typing a path ending in a separator
+// goes to that directory if it exists.
+// Must be called with fb.lock held.
+func (fb *fileBrowser) typed() {
+	in := string(fb.input)
+	if !strings.HasSuffix(in, string(filepath.Separator)) {
+		fb.refilter()
+		return
+	}
+	dir := fb.path(in)
+	if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+		fb.chdir(dir)
+		return
+	}
+	fb.refilter()
+}
+
+// choose works out the result of pressing enter, returning nil if the
+// prompt should stay open.
+// Must be called with fb.lock held.
+func (fb *fileBrowser) choose() []string {
+	if len(fb.marked) > 0 {
+		var ret []string
+		for fn := range fb.marked {
+			ret = append(ret, fn)
+		}
+		sort.Strings(ret)
+		return ret
+	}
+	if fb.flags&backend.PROMPT_SAVE_AS != 0 && len(fb.input) > 0 {
+		// Save to the typed name unless it picks out a directory
+		if len(fb.matches) == 0 || !fb.matches[fb.selected].dir {
+			return []string{fb.path(string(fb.input))}
+		}
+	}
+	if len(fb.matches) == 0 {
+		return nil
+	}
+	e := fb.matches[fb.selected]
+	switch {
+	case e.name == currentDirEntry:
+		return []string{fb.dir}
+	case e.dir:
+		fb.chdir(filepath.Join(fb.dir, e.name))
+		return nil
+	}
+	return []string{filepath.Join(fb.dir, e.name)}
+}
+
+func (fb *fileBrowser) done(files []string) {
+	fb.t.hideOverlay(fb)
+	fb.result <- files
+}
+
+func (fb *fileBrowser) cancel() {
+	fb.done(nil)
+}
+
+// move moves the selection by delta entries, keeping it visible.
+// Must be called with fb.lock held.
+func (fb *fileBrowser) move(delta int) {
+	fb.selected += delta
+	if fb.selected >= len(fb.matches) {
+		fb.selected = len(fb.matches) - 1
+	}
+	if fb.selected < 0 {
+		fb.selected = 0
+	}
+	if fb.selected < fb.scroll {
+		fb.scroll = fb.selected
+	} else if fb.selected >= fb.scroll+quickPanelRows {
+		fb.scroll = fb.selected - quickPanelRows + 1
+	}
+}
+
+func (fb *fileBrowser) handleInput(kp keys.KeyPress) {
+	fb.lock.Lock()
+	switch {
+	case kp.Key == keys.Escape:
+		fb.lock.Unlock()
+		fb.done(nil)
+		return
+	case kp.Key == keys.Enter:
+		if files := fb.choose(); files != nil {
+			fb.lock.Unlock()
+			fb.done(files)
+			return
+		}
+	case kp.Key == '\t':
+		fb.complete()
+	case kp.Key == keys.Up:
+		fb.move(-1)
+	case kp.Key == keys.Down:
+		fb.move(1)
+	case kp.Key == keys.PageUp:
+		fb.move(-quickPanelRows)
+	case kp.Key == keys.PageDown:
+		fb.move(quickPanelRows)
+	case kp.Key == keys.Backspace:
+		if len(fb.input) == 0 {
+			fb.chdir(filepath.Dir(fb.dir))
+		} else {
+			fb.input = fb.input[:len(fb.input)-1]
+			fb.refilter()
+		}
+	case kp.Ctrl && kp.Key == 't':
+		fb.hidden = !fb.hidden
+		fb.reload()
+	case kp.Ctrl && kp.Key == ' ':
+		if fb.flags&backend.PROMPT_SELECT_MULTIPLE != 0 && len(fb.matches) > 0 {
+			if e := fb.matches[fb.selected]; !e.dir || fb.flags&backend.PROMPT_ONLY_FOLDER != 0 {
+				fn := filepath.Join(fb.dir, e.name)
+				if fb.marked[fn] {
+					delete(fb.marked, fn)
+				} else {
+					fb.marked[fn] = true
+				}
+				fb.move(1)
+			}
+		}
+	case isText(kp):
+		fb.input = append(fb.input, []rune(kp.Text)...)
+		fb.typed()
+	}
+	fb.lock.Unlock()
+	fb.t.render()
+}
+
+func (fb *fileBrowser) render(w, h int) {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	width := quickPanelWidth
+	if width > w-4 {
+		width = w - 4
+	}
+	x, y := (w-width)/2, 1
+	rows := quickPanelRows
+	if rows > h-y-4 {
+		rows = h - y - 4
+	}
+
+	fill := func(y int, bg termbox.Attribute) {
+		for i := x; i < x+width; i++ {
+			scr.SetCell(i, y, ' ', defaultFg, bg)
+		}
+	}
+
+	fill(y, overlayBg)
+	addString(x+1, y, fb.title, defaultFg|termbox.AttrBold, overlayBg)
+	hint := "tab: complete  ctrl+t: hidden files"
+	if fb.flags&backend.PROMPT_SELECT_MULTIPLE != 0 {
+		hint += "  ctrl+space: mark"
+	}
+	addString(x+width-1-len(hint), y, hint, defaultFg, overlayBg)
+
+	fill(y+1, overlayBg)
+	dir := []rune(fb.dir + string(filepath.Separator))
+	// Keep the end of long paths, where the input is
+	if room := width - 4 - len(fb.input); len(dir) > room && room > 0 {
+		dir = append([]rune("…"), dir[len(dir)-room+1:]...)
+	}
+	cx := addString(x+1, y+1, "> "+string(dir), defaultFg, overlayBg)
+	cx = addString(cx, y+1, string(fb.input), defaultFg, overlayBg)
+	scr.SetCursor(cx, y+1)
+
+	row := y + 2
+	if fb.err != nil {
+		fill(row, overlayBg)
+		addString(x+1, row, fb.err.Error(), defaultFg, overlayBg)
+		return
+	}
+	for i := fb.scroll; i < len(fb.matches) && row < y+2+rows; i++ {
+		e := fb.matches[i]
+		bg := overlayBg
+		if i == fb.selected {
+			bg = selectionBg
+		}
+		fill(row, bg)
+		mark := "  "
+		if fb.marked[filepath.Join(fb.dir, e.name)] {
+			mark = "* "
+		}
+		name := e.name
+		if e.dir && name != currentDirEntry {
+			name += string(filepath.Separator)
+		}
+		addString(x+1, row, mark+name, defaultFg, bg)
+		row++
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/keys"
+)
+
+func TestCommonPrefix(t *testing.T) {
+	tests := []struct {
+		names []string
+		exp   string
+	}{
+		{nil, ""},
+		{[]string{"main.go"}, "main.go"},
+		{[]string{"main.go", "main_test.go"}, "main"},
+		{[]string{"frontend.go", "termbox.go"}, ""},
+	}
+
+	for i, test := range tests {
+		if p := commonPrefix(test.names); p != test.exp {
+			t.Errorf("Test %d: Expected %q, got %q", i, test.exp, p)
+		}
+	}
+}
+
+func TestReadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lime-termbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, fn := range []string{"b.go", "a.go", ".hidden"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, fn), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		hidden, onlyDirs bool
+		exp              []fileEntry
+	}{
+		{false, false, []fileEntry{{"sub", true}, {"a.go", false}, {"b.go", false}}},
+		{true, false, []fileEntry{{"sub", true}, {".hidden", false}, {"a.go", false}, {"b.go", false}}},
+		{false, true, []fileEntry{{"sub", true}}},
+	}
+
+	for i, test := range tests {
+		es, err := readDir(dir, test.hidden, test.onlyDirs)
+		if err != nil {
+			t.Fatalf("Test %d: %s", i, err)
+		}
+		if !reflect.DeepEqual(es, test.exp) {
+			t.Errorf("Test %d: Expected %v, got %v", i, test.exp, es)
+		}
+	}
+}
+
+func TestFileBrowserPath(t *testing.T) {
+	home := os.Getenv("HOME")
+	defer os.Setenv("HOME", home)
+	os.Setenv("HOME", "/home/lime")
+
+	tests := []struct {
+		input, exp string
+	}{
+		{"a.go", "/work/a.go"},
+		{"sub/a.go", "/work/sub/a.go"},
+		{"/tmp/a.go", "/tmp/a.go"},
+		{"~", "/home/lime"},
+		{"~/a.go", "/home/lime/a.go"},
+		{"~a.go", "/work/~a.go"},
+	}
+
+	for i, test := range tests {
+		fb := &fileBrowser{dir: "/work", flags: backend.PROMPT_SAVE_AS, input: []rune(test.input)}
+		if files := fb.choose(); !reflect.DeepEqual(files, []string{test.exp}) {
+			t.Errorf("Test %d: Expected to save as %s, got %v", i, test.exp, files)
+		}
+	}
+}
+
+func TestFileBrowserPaste(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lime-termbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, fn := range []string{"abc.go", "abd.go"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, fn), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fe := &tbfe{
+		dorender:  make(chan bool, render_chan_len),
+		layout:    make(map[*backend.View]layout),
+		groups:    []*group{{}},
+		winLayout: singleLayout,
+	}
+	fb := &fileBrowser{t: fe, marked: make(map[string]bool)}
+	fb.chdir(dir)
+	fe.overlay = fb
+
+	// Only a typed tab completes the name
+	fe.handlePaste("a\t")
+	if in := string(fb.input); in != "a" {
+		t.Errorf("Expected the pasted tab to be left out, but the input is %q", in)
+	}
+	fe.handleInput(inputEvent{kp: &keys.KeyPress{Key: '\t'}})
+	if in := string(fb.input); in != "ab" {
+		t.Errorf("Expected the typed tab to complete the input, but it is %q", in)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/limetext/backend/log"
+	py "github.com/limetext/gopy"
+)
+
+// pyModuleName is the python module through which sublime_plugin.py
+// reaches the parts of the window api only the frontend provides, like
+// the quick panel.
+const pyModuleName = "lime_termbox"
+
+// pyCallback is a python callable the frontend holds on to until release
+// is called. A nil pyCallback stands for None, and calling it does
+// nothing.
+type pyCallback struct {
+	f py.Object
+}
+
+func newPyCallback(f py.Object) *pyCallback {
+	if _, ok := f.(*py.NoneObject); ok {
+		return nil
+	}
+	f.Incref()
+	return &pyCallback{f}
+}
+
+// call calls the callable with args, which it takes the references of.
+func (c *pyCallback) call(args ...py.Object) {
+	if c == nil {
+		return
+	}
+	l := py.NewLock()
+	defer l.Unlock()
+	defer func() {
+		for _, a := range args {
+			a.Decref()
+		}
+	}()
+	if ret, err := c.f.Base().CallFunctionObjArgs(args...); err != nil {
+		log.Error("Error in callback: %s", err)
+	} else {
+		ret.Decref()
+	}
+}
+
+func (c *pyCallback) callInt(i int) {
+	if c != nil {
+		c.call(py.NewLong(int64(i)))
+	}
+}
+
+func (c *pyCallback) release() {
+	if c == nil {
+		return
+	}
+	l := py.NewLock()
+	defer l.Unlock()
+	c.f.Decref()
+}
+
+func (c *pyCallback) callString(s string) {
+	if c == nil {
+		return
+	}
+	if u, err := py.NewUnicode(s); err != nil {
+		log.Error(err)
+	} else {
+		c.call(u)
+	}
+}
+
+// pyString returns the text of a python string.
+func pyString(o py.Object) (string, error) {
+	if s, ok := o.(*py.Unicode); ok {
+		return s.String(), nil
+	}
+	return "", fmt.Errorf("Expected a string, not %s", o.Type())
+}
+
+// pySlice returns the items of a python list or tuple.
+func pySlice(o py.Object) ([]py.Object, error) {
+	switch o := o.(type) {
+	case *py.List:
+		return o.Slice(), nil
+	case *py.Tuple:
+		return o.Slice(), nil
+	}
+	return nil, fmt.Errorf("Expected a list, not %s", o.Type())
+}
+
+// pyQuickPanelItems converts the items given to show_quick_panel, which
+// are strings or lists of strings.
+func pyQuickPanelItems(o py.Object) ([][]string, error) {
+	objs, err := pySlice(o)
+	if err != nil {
+		return nil, err
+	}
+	items := make([][]string, len(objs))
+	for i, obj := range objs {
+		if s, err := pyString(obj); err == nil {
+			items[i] = []string{s}
+			continue
+		}
+		lines, err := pySlice(obj)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range lines {
+			s, err := pyString(l)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = append(items[i], s)
+		}
+	}
+	return items, nil
+}
+
+// pyShowQuickPanel is show_quick_panel(items, on_done, flags,
+// selected_index, on_highlight).
+func pyShowQuickPanel(tu *py.Tuple) (py.Object, error) {
+	t := frontend()
+	if t == nil {
+		return nil, errNoFrontend
+	}
+	if tu.Size() != 5 {
+		return nil, fmt.Errorf("Unexpected argument count: %d", tu.Size())
+	}
+	args := tu.Slice()
+	items, err := pyQuickPanelItems(args[0])
+	if err != nil {
+		return nil, err
+	}
+	selected, ok := args[3].(*py.Long)
+	if !ok {
+		return nil, fmt.Errorf("Expected int not %s", args[3].Type())
+	}
+
+	// done is called off the main loop, so on_done can show a dialog
+	onDone, onHighlight := newPyCallback(args[1]), newPyCallback(args[4])
+	done := func(i int) {
+		onDone.callInt(i)
+		onDone.release()
+		onHighlight.release()
+	}
+	var highlight func(int)
+	if onHighlight != nil {
+		highlight = onHighlight.callInt
+	}
+	t.ShowQuickPanel(items, int(selected.Int64()), done, highlight)
+
+	py.None.Incref()
+	return py.None, nil
+}
+
+// pyShowInputPanel is show_input_panel(caption, initial_text, on_done,
+// on_change, on_cancel). It returns the id of the view backing the panel,
+// which sublime_plugin.py turns into the view itself.
+func pyShowInputPanel(tu *py.Tuple) (py.Object, error) {
+	t := frontend()
+	if t == nil {
+		return nil, errNoFrontend
+	}
+	if tu.Size() != 5 {
+		return nil, fmt.Errorf("Unexpected argument count: %d", tu.Size())
+	}
+	args := tu.Slice()
+	caption, err := pyString(args[0])
+	if err != nil {
+		return nil, err
+	}
+	initial, err := pyString(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	onDone, onChange, onCancel := newPyCallback(args[2]), newPyCallback(args[3]), newPyCallback(args[4])
+	release := func() {
+		onDone.release()
+		onChange.release()
+		onCancel.release()
+	}
+	done := func(s string) {
+		onDone.callString(s)
+		release()
+	}
+	cancel := func() {
+		onCancel.call()
+		release()
+	}
+	var change func(string)
+	if onChange != nil {
+		change = onChange.callString
+	}
+	v := t.ShowInputPanel(caption, initial, done, change, cancel)
+	return py.NewLong(int64(v.Id())), nil
+}
+
+func init() {
+	l := py.NewLock()
+	defer l.Unlock()
+
+	methods := []py.Method{
+		{Name: "show_quick_panel", Func: pyShowQuickPanel},
+		{Name: "show_input_panel", Func: pyShowInputPanel},
+	}
+	if _, err := py.InitModule(pyModuleName, methods); err != nil {
+		log.Error("Couldn't create the %s python module: %s", pyModuleName, err)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/keys"
+	py "github.com/limetext/gopy"
+)
+
+// pyTest imports the python module imp from testdata, which runs it.
+func pyTest(t *testing.T, imp string) {
+	l := py.NewLock()
+	defer l.Unlock()
+	py.AddToPath("testdata")
+	if _, err := py.Import(imp); err != nil {
+		t.Fatalf("Error importing %s: %s", imp, err)
+	}
+}
+
+func TestPyQuickPanel(t *testing.T) {
+	fe := createFrontend()
+	pyTest(t, "quick_panel_plugin")
+
+	qp, ok := fe.overlay.(*quickPanel)
+	if !ok {
+		t.Fatalf("Expected the plugin to show a quick panel, but got %v", fe.overlay)
+	}
+	if len(qp.items) != 2 || len(qp.items[1]) != 2 {
+		t.Errorf("Expected the items of the plugin, but got %v", qp.items)
+	}
+	fe.handleInput(inputEvent{kp: &keys.KeyPress{Key: keys.Down}})
+	fe.handleInput(inputEvent{kp: &keys.KeyPress{Key: keys.Enter}})
+
+	// on_done is called off the main loop, so it's waited for
+	w := backend.GetEditor().ActiveWindow()
+	picked := func() int {
+		i, _ := w.Settings().Get("picked", -1).(int)
+		return i
+	}
+	for i := 0; i < 100 && picked() != 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if i := picked(); i != 1 {
+		t.Errorf("Expected the plugin to be told item 1 was picked, but got %d", i)
+	}
+}
+
+func TestPyInputPanel(t *testing.T) {
+	fe := createFrontend()
+	pyTest(t, "input_panel_plugin")
+
+	fe.lock.Lock()
+	ip := fe.inputPanel
+	fe.lock.Unlock()
+	if ip == nil {
+		t.Fatal("Expected the plugin to show an input panel")
+	}
+	// The panel holds a single line, so pasted line breaks are left out.
+	// The paste is inserted by the editor's input handling, so it's
+	// waited for.
+	fe.handlePaste("bar\r\nbaz\n")
+	for i := 0; i < 100 && ip.text() != "foobarbaz"; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if text := ip.text(); text != "foobarbaz" {
+		t.Errorf("Expected the panel to hold %q, but got %q", "foobarbaz", text)
+	}
+	// Enter closes the panel once the editor gets to it, and on_done is
+	// called off the main loop, so the answer is waited for
+	fe.handleInput(inputEvent{kp: &keys.KeyPress{Key: keys.Enter}})
+
+	w := backend.GetEditor().ActiveWindow()
+	answer := func() string {
+		s, _ := w.Settings().Get("answer", "").(string)
+		return s
+	}
+	for i := 0; i < 100 && answer() != "foobarbaz"; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s := answer(); s != "foobarbaz" {
+		t.Errorf("Expected the plugin to get %q, but got %q", "foobarbaz", s)
+	}
+}
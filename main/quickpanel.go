@@ -0,0 +1,247 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+
+	"github.com/limetext/backend/keys"
+	"github.com/nsf/termbox-go"
+)
+
+// quickPanel is the overlay behind show_quick_panel: a list of items
+// narrowed down by fuzzy matching what the user types.
+type quickPanel struct {
+	t           *tbfe
+	lock        sync.Mutex
+	items       [][]string
+	hints       []string
+	filter      []rune
+	matches     []fuzzyMatch
+	selected    int
+	scroll      int
+	onDone      func(int)
+	onHighlight func(int)
+}
+
+const (
+	quickPanelWidth = 80
+	quickPanelRows  = 15
+)
+
+// ShowQuickPanel shows items in a filterable list on top of the views.
+// Every item is one or more lines of text, and the first line is what
+// the filter matches against. onDone is called in its own goroutine with
+// the index of the chosen item, or -1 if the panel was cancelled, so it
+// may block on the main loop, e.g. to show a dialog. If onHighlight isn't
+// nil it is called with the index of the item under the selection
+// whenever that changes.
+func (t *tbfe) ShowQuickPanel(items [][]string, selected int, onDone, onHighlight func(int)) {
+	t.showQuickPanel(newQuickPanel(t, items, onDone, onHighlight), selected)
+}
+
+func newQuickPanel(t *tbfe, items [][]string, onDone, onHighlight func(int)) *quickPanel {
+	qp := &quickPanel{
+		t:           t,
+		items:       items,
+		onDone:      onDone,
+		onHighlight: onHighlight,
+	}
+	qp.refilter()
+	return qp
+}
+
+func (t *tbfe) showQuickPanel(qp *quickPanel, selected int) {
+	for i, m := range qp.matches {
+		if m.index == selected {
+			qp.move(i)
+		}
+	}
+	qp.highlight()
+	t.showOverlay(qp)
+}
+
+// refilter updates the matches after the filter has changed.
+// Must be called with qp.lock held.
+func (qp *quickPanel) refilter() {
+	firsts := make([]string, len(qp.items))
+	for i, it := range qp.items {
+		if len(it) > 0 {
+			firsts[i] = it[0]
+		}
+	}
+	qp.matches = fuzzyFilter(qp.filter, firsts)
+	qp.selected, qp.scroll = 0, 0
+}
+
+// highlight notifies onHighlight of the selected item.
+func (qp *quickPanel) highlight() {
+	if qp.onHighlight == nil || len(qp.matches) == 0 {
+		return
+	}
+	qp.onHighlight(qp.matches[qp.selected].index)
+}
+
+// done hides the panel and hands index to onDone. It's called from the
+// main loop, which onDone mustn't hold up.
+func (qp *quickPanel) done(index int) {
+	qp.t.hideOverlay(qp)
+	if qp.onDone != nil {
+		go qp.onDone(index)
+	}
+}
+
+func (qp *quickPanel) cancel() {
+	qp.done(-1)
+}
+
+// itemHeight returns the number of lines each item takes up.
+func (qp *quickPanel) itemHeight() int {
+	h := 1
+	for _, it := range qp.items {
+		if len(it) > h {
+			h = len(it)
+		}
+	}
+	return h
+}
+
+// move moves the selection by delta items, clamping it to the matches
+// and scrolling so that it stays visible.
+// Must be called with qp.lock held.
+func (qp *quickPanel) move(delta int) {
+	qp.selected += delta
+	if qp.selected >= len(qp.matches) {
+		qp.selected = len(qp.matches) - 1
+	}
+	if qp.selected < 0 {
+		qp.selected = 0
+	}
+
+	n := quickPanelRows / qp.itemHeight()
+	if qp.selected < qp.scroll {
+		qp.scroll = qp.selected
+	} else if qp.selected >= qp.scroll+n {
+		qp.scroll = qp.selected - n + 1
+	}
+}
+
+func (qp *quickPanel) handleInput(kp keys.KeyPress) {
+	qp.lock.Lock()
+	prev := qp.selected
+	pageSize := quickPanelRows / qp.itemHeight()
+
+	switch {
+	case kp.Key == keys.Escape:
+		qp.lock.Unlock()
+		qp.done(-1)
+		return
+	case kp.Key == keys.Enter:
+		index := -1
+		if len(qp.matches) > 0 {
+			index = qp.matches[qp.selected].index
+		}
+		qp.lock.Unlock()
+		qp.done(index)
+		return
+	case kp.Key == keys.Up || (kp.Ctrl && kp.Key == 'p'):
+		qp.move(-1)
+	case kp.Key == keys.Down || (kp.Ctrl && kp.Key == 'n'):
+		qp.move(1)
+	case kp.Key == keys.PageUp:
+		qp.move(-pageSize)
+	case kp.Key == keys.PageDown:
+		qp.move(pageSize)
+	case kp.Key == keys.Backspace:
+		if len(qp.filter) == 0 {
+			break
+		}
+		qp.filter = qp.filter[:len(qp.filter)-1]
+		qp.refilter()
+		prev = -1
+	case isText(kp):
+		qp.filter = append(qp.filter, []rune(kp.Text)...)
+		qp.refilter()
+		prev = -1
+	}
+	changed := qp.selected != prev
+	qp.lock.Unlock()
+
+	if changed {
+		qp.highlight()
+	}
+	qp.t.render()
+}
+
+func (qp *quickPanel) render(w, h int) {
+	qp.lock.Lock()
+	defer qp.lock.Unlock()
+
+	width := quickPanelWidth
+	if width > w-4 {
+		width = w - 4
+	}
+	x, y := (w-width)/2, 1
+	ih := qp.itemHeight()
+	rows := quickPanelRows / ih * ih
+	if rows > h-y-3 {
+		rows = (h - y - 3) / ih * ih
+	}
+
+	fill := func(y int, bg termbox.Attribute) {
+		for i := x; i < x+width; i++ {
+			scr.SetCell(i, y, ' ', defaultFg, bg)
+		}
+	}
+
+	fill(y, overlayBg)
+	cx := addString(x+1, y, "> ", defaultFg, overlayBg)
+	cx = addString(cx, y, string(qp.filter), defaultFg, overlayBg)
+	scr.SetCursor(cx, y)
+
+	row := y + 1
+	for i := qp.scroll; i < len(qp.matches) && row+ih <= y+1+rows; i++ {
+		m := qp.matches[i]
+		bg := overlayBg
+		if i == qp.selected {
+			bg = selectionBg
+		}
+		bold := make(map[int]bool, len(m.positions))
+		for _, p := range m.positions {
+			bold[p] = true
+		}
+		for j := 0; j < ih; j++ {
+			fill(row, bg)
+			// The first line is cut short to leave room for the hint
+			end := x + width - 1
+			if j == 0 && m.index < len(qp.hints) && qp.hints[m.index] != "" {
+				hint := qp.hints[m.index]
+				end -= stringWidth(hint) + 1
+				addString(end+1, row, hint, defaultFg, bg)
+			}
+			if it := qp.items[m.index]; j < len(it) {
+				cx := x + 1
+				rs := []rune(it[j])
+				for k := 0; k < len(rs); k++ {
+					rw := runeWidth(rs[k])
+					if cx+rw > end {
+						break
+					}
+					fg := defaultFg
+					if j == 0 && bold[k] {
+						fg |= termbox.AttrBold
+					}
+					if rw > 0 {
+						r, n := cluster(rs, k)
+						scr.SetCell(cx, row, r, fg, bg)
+						k += n - 1
+					}
+					cx += rw
+				}
+			}
+			row++
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"sync"
+
+	"github.com/nsf/termbox-go"
+)
+
+type (
+	// screen is what the frontend draws on and reads its input from.
+	// The methods work like the termbox functions of the same name.
+	screen interface {
+		SetCell(x, y int, ch rune, fg, bg termbox.Attribute)
+		Size() (width, height int)
+		Clear(fg, bg termbox.Attribute) error
+		Flush() error
+		// CellBuffer returns the cells drawn since the last Flush, row by
+		// row.
+		CellBuffer() []termbox.Cell
+		SetCursor(x, y int)
+		HideCursor()
+		// PollEvent waits for the next event. Keyboard input isn't
+		// decoded, but read into data and returned as an EventRaw.
+		PollEvent(data []byte) termbox.Event
+		// WriteRaw writes s to the terminal as it is, for escape
+		// sequences termbox doesn't know about.
+		WriteRaw(s string) error
+		// Interrupt makes PollEvent return an EventInterrupt. It waits
+		// for PollEvent to be called if it isn't being waited for.
+		Interrupt()
+	}
+
+	// termboxScreen is the terminal, as set up by termbox.Init.
+	termboxScreen struct{}
+
+	// memScreen is a screen kept in memory, for running the frontend
+	// without a terminal. Its input is sent with Input and Send.
+	memScreen struct {
+		lock          sync.Mutex
+		width, height int
+		cells         []termbox.Cell
+		// The cells as of the last Flush
+		flushed []termbox.Cell
+		cursorX int
+		cursorY int
+		input   chan rawInput
+		// Input that didn't fit in the data passed to PollEvent
+		pending []byte
+		// What was written with WriteRaw
+		raw bytes.Buffer
+	}
+)
+
+// scr is the screen the frontend uses.
+var scr screen = termboxScreen{}
+
+func (termboxScreen) SetCell(x, y int, ch rune, fg, bg termbox.Attribute) {
+	termbox.SetCell(x, y, ch, fg, bg)
+}
+
+func (termboxScreen) Size() (int, int) {
+	return termbox.Size()
+}
+
+func (termboxScreen) Clear(fg, bg termbox.Attribute) error {
+	return termbox.Clear(fg, bg)
+}
+
+func (termboxScreen) Flush() error {
+	return termbox.Flush()
+}
+
+func (termboxScreen) CellBuffer() []termbox.Cell {
+	return termbox.CellBuffer()
+}
+
+func (termboxScreen) SetCursor(x, y int) {
+	termbox.SetCursor(x, y)
+}
+
+func (termboxScreen) HideCursor() {
+	termbox.HideCursor()
+}
+
+func (termboxScreen) PollEvent(data []byte) termbox.Event {
+	return termbox.PollRawEvent(data)
+}
+
+func (termboxScreen) WriteRaw(s string) error {
+	_, err := os.Stdout.WriteString(s)
+	return err
+}
+
+func (termboxScreen) Interrupt() {
+	termbox.Interrupt()
+}
+
+func newMemScreen(width, height int) *memScreen {
+	s := &memScreen{input: make(chan rawInput, 32)}
+	s.resize(width, height)
+	return s
+}
+
+// resize sets the size of s and clears it.
+// Must be called with s.lock held.
+func (s *memScreen) resize(width, height int) {
+	s.width, s.height = width, height
+	s.cells = make([]termbox.Cell, width*height)
+	s.flushed = make([]termbox.Cell, width*height)
+	s.cursorX, s.cursorY = -1, -1
+}
+
+func (s *memScreen) SetCell(x, y int, ch rune, fg, bg termbox.Attribute) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if x < 0 || x >= s.width || y < 0 || y >= s.height {
+		return
+	}
+	s.cells[y*s.width+x] = termbox.Cell{Ch: ch, Fg: fg, Bg: bg}
+}
+
+func (s *memScreen) Size() (int, int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.width, s.height
+}
+
+func (s *memScreen) Clear(fg, bg termbox.Attribute) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i := range s.cells {
+		s.cells[i] = termbox.Cell{Ch: ' ', Fg: fg, Bg: bg}
+	}
+	return nil
+}
+
+func (s *memScreen) Flush() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	copy(s.flushed, s.cells)
+	return nil
+}
+
+// CellBuffer returns a copy of the cells, as they're changed by whoever
+// draws on s while they're being read.
+func (s *memScreen) CellBuffer() []termbox.Cell {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	cells := make([]termbox.Cell, len(s.cells))
+	copy(cells, s.cells)
+	return cells
+}
+
+func (s *memScreen) SetCursor(x, y int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cursorX, s.cursorY = x, y
+}
+
+func (s *memScreen) HideCursor() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cursorX, s.cursorY = -1, -1
+}
+
+func (s *memScreen) PollEvent(data []byte) termbox.Event {
+	if len(s.pending) == 0 {
+		in := <-s.input
+		if in.ev.Type != termbox.EventRaw {
+			return in.ev
+		}
+		s.pending = in.data
+	}
+	n := copy(data, s.pending)
+	s.pending = s.pending[n:]
+	return termbox.Event{Type: termbox.EventRaw, N: n}
+}
+
+func (s *memScreen) WriteRaw(data string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.raw.WriteString(data)
+	return nil
+}
+
+// Written returns what was written to s with WriteRaw.
+func (s *memScreen) Written() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.raw.String()
+}
+
+func (s *memScreen) Interrupt() {
+	s.input <- rawInput{termbox.Event{Type: termbox.EventInterrupt}, nil}
+}
+
+// Input sends data to the frontend as if it was typed.
+func (s *memScreen) Input(data string) {
+	s.input <- rawInput{termbox.Event{Type: termbox.EventRaw}, []byte(data)}
+}
+
+// Send sends ev to the frontend. Resize events resize the screen first.
+func (s *memScreen) Send(ev termbox.Event) {
+	if ev.Type == termbox.EventResize {
+		s.lock.Lock()
+		s.resize(ev.Width, ev.Height)
+		s.lock.Unlock()
+	}
+	s.input <- rawInput{ev, nil}
+}
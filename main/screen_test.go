@@ -0,0 +1,169 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/limetext/backend/keys"
+	"github.com/nsf/termbox-go"
+)
+
+func TestMemScreen(t *testing.T) {
+	s := newMemScreen(4, 2)
+	s.Clear(termbox.ColorWhite, termbox.ColorBlack)
+	s.SetCell(1, 1, 'a', termbox.ColorRed, termbox.ColorBlue)
+	s.SetCell(4, 0, 'b', termbox.ColorRed, termbox.ColorBlue)
+	s.SetCell(0, -1, 'c', termbox.ColorRed, termbox.ColorBlue)
+
+	tests := []struct {
+		i   int
+		exp termbox.Cell
+	}{
+		{0, termbox.Cell{Ch: ' ', Fg: termbox.ColorWhite, Bg: termbox.ColorBlack}},
+		{3, termbox.Cell{Ch: ' ', Fg: termbox.ColorWhite, Bg: termbox.ColorBlack}},
+		{5, termbox.Cell{Ch: 'a', Fg: termbox.ColorRed, Bg: termbox.ColorBlue}},
+	}
+	for i, test := range tests {
+		if c := s.CellBuffer()[test.i]; c != test.exp {
+			t.Errorf("Test %d: Expected %v, but got %v", i, test.exp, c)
+		}
+	}
+
+	// The cells returned are a copy
+	s.CellBuffer()[5].Ch = 'x'
+	if c := s.CellBuffer()[5]; c.Ch != 'a' {
+		t.Errorf("Expected the cell buffer to be a copy, but it was changed to %v", c)
+	}
+
+	if c := s.flushed[5]; c.Ch != 0 {
+		t.Errorf("Expected the cells not to be flushed yet, but got %v", c)
+	}
+	s.Flush()
+	if c := s.flushed[5]; c.Ch != 'a' {
+		t.Errorf("Expected 'a' to be flushed, but got %v", c)
+	}
+}
+
+func TestMemScreenInput(t *testing.T) {
+	s := newMemScreen(4, 2)
+	s.Input("abcdef")
+	s.Send(termbox.Event{Type: termbox.EventResize, Width: 8, Height: 3})
+
+	tests := []struct {
+		typ  termbox.EventType
+		data string
+	}{
+		{termbox.EventRaw, "abcd"},
+		{termbox.EventRaw, "ef"},
+		{termbox.EventResize, ""},
+	}
+	for i, test := range tests {
+		data := make([]byte, 4)
+		ev := s.PollEvent(data)
+		if ev.Type != test.typ {
+			t.Errorf("Test %d: Expected event type %v, but got %v", i, test.typ, ev.Type)
+		} else if d := string(data[:ev.N]); d != test.data {
+			t.Errorf("Test %d: Expected %q, but got %q", i, test.data, d)
+		}
+	}
+
+	if w, h := s.Size(); w != 8 || h != 3 {
+		t.Errorf("Expected the screen to be 8x3, but got %dx%d", w, h)
+	}
+}
+
+func TestMemScreenWriteRaw(t *testing.T) {
+	s := newMemScreen(4, 2)
+	old := scr
+	scr = s
+	defer func() { scr = old }()
+
+	fe := &tbfe{dorender: make(chan bool, render_chan_len)}
+	enableKeyReporting()
+	fe.writeEscape("\x1b]52;c;YQ==\a")
+	fe.flushEscapes()
+	disableKeyReporting()
+
+	exp := "\x1b[>4;2m\x1b[?2004h" + "\x1b]52;c;YQ==\a" + "\x1b[>4m\x1b[?2004l"
+	if w := s.Written(); w != exp {
+		t.Errorf("Expected %q to be written, but got %q", exp, w)
+	}
+}
+
+// keyRecorder is an overlay that records the keys sent to it.
+type keyRecorder chan keys.KeyPress
+
+func (keyRecorder) render(w, h int)                {}
+func (keyRecorder) cancel()                        {}
+func (r keyRecorder) handleInput(kp keys.KeyPress) { r <- kp }
+
+func TestScreenInput(t *testing.T) {
+	s := newMemScreen(4, 2)
+	old := scr
+	scr = s
+	defer func() { scr = old }()
+
+	rec := make(keyRecorder, 32)
+	fe := &tbfe{overlay: rec}
+	evchan := make(chan inputEvent, 32)
+	quit := make(chan bool)
+	defer close(quit)
+	go pollEvents(s, evchan, quit)
+
+	s.Input("a\x01\x1b[1;5C")
+	// A lone escape is only taken as the escape key after a while
+	s.Input("\x1b")
+
+	exp := []keys.KeyPress{
+		{Key: 'a'},
+		{Key: 'a', Ctrl: true},
+		{Key: keys.Right, Ctrl: true},
+		{Key: keys.Escape},
+	}
+	for i, kp := range exp {
+		select {
+		case ev := <-evchan:
+			fe.handleInput(ev)
+		case <-time.After(time.Second):
+			t.Fatalf("Test %d: Expected %v, but no event came", i, kp)
+		}
+		select {
+		case got := <-rec:
+			if got.Key != kp.Key || got.Ctrl != kp.Ctrl || got.Alt != kp.Alt || got.Shift != kp.Shift {
+				t.Errorf("Test %d: Expected %v, but got %v", i, kp, got)
+			}
+		default:
+			t.Errorf("Test %d: Expected %v, but no key was handled", i, kp)
+		}
+	}
+}
+
+func TestPollEventsQuit(t *testing.T) {
+	s := newMemScreen(4, 2)
+	quit := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		pollEvents(s, make(chan inputEvent), quit)
+		done <- true
+	}()
+
+	// Input nobody reads mustn't keep it from stopping
+	s.Input("a")
+	close(quit)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected pollEvents to return when quit was closed")
+	}
+	// Its reader stops at the interrupt it sent, reading the input
+	for i := 0; i < 100 && len(s.input) > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if n := len(s.input); n != 0 {
+		t.Errorf("Expected the input to be read, but %d events are left", n)
+	}
+}
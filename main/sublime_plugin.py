@@ -6,6 +6,53 @@ import imp
 import sublime
 import sys
 import importlib
+import lime_termbox
+
+
+class Window(object):
+    """Adds the panels of the frontend to a sublime.Window, which can't
+    be extended itself, and passes everything else on to it."""
+
+    def __init__(self, wnd):
+        if isinstance(wnd, Window):
+            wnd = wnd.wnd
+        self.wnd = wnd
+
+    def __getattr__(self, name):
+        return getattr(self.wnd, name)
+
+    def show_quick_panel(self, items, on_done, flags=0, selected_index=-1,
+                         on_highlight=None):
+        lime_termbox.show_quick_panel(items, on_done, flags, selected_index,
+                                      on_highlight)
+
+    def show_input_panel(self, caption, initial_text, on_done, on_change,
+                         on_cancel):
+        vid = lime_termbox.show_input_panel(caption, initial_text, on_done,
+                                            on_change, on_cancel)
+        # The panel is shown in the window the frontend has active
+        for w in _windows():
+            for v in w.views():
+                if v.id() == vid:
+                    return v
+
+
+_active_window = sublime.active_window
+_windows = sublime.windows
+
+
+def active_window():
+    w = _active_window()
+    if w is None:
+        return None
+    return Window(w)
+
+
+def windows():
+    return [Window(w) for w in _windows()]
+
+sublime.active_window = active_window
+sublime.windows = windows
 
 
 class Command(object):
@@ -24,7 +71,7 @@ class ApplicationCommand(Command):
 class WindowCommand(Command):
 
     def __init__(self, wnd):
-        self.window = wnd
+        self.window = Window(wnd)
 
     def run_(self, kwargs):
         if kwargs and 'event' in kwargs:
@@ -0,0 +1,213 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/limetext/backend"
+	"github.com/nsf/termbox-go"
+)
+
+type (
+	NextViewCommand struct {
+		backend.DefaultCommand
+	}
+
+	PrevViewCommand struct {
+		backend.DefaultCommand
+	}
+
+	SelectByIndexCommand struct {
+		backend.DefaultCommand
+		Index int
+	}
+)
+
+const tabbarHeight = 1
+
+// viewName returns the name of view v shown to the user.
+func viewName(v *backend.View) string {
+	name := v.Name()
+	if fn := v.FileName(); fn != "" {
+		name = filepath.Base(fn)
+	} else if name == "" {
+		name = "untitled"
+	}
+	return name
+}
+
+// tabLabel returns the text shown in the tab of view v.
+func tabLabel(v *backend.View) string {
+	name := viewName(v)
+	if v.IsDirty() {
+		name += " •"
+	}
+	return " " + name + " "
+}
+
+// firstTab returns the index of the first tab to draw so that the active
+// tab fits within width cells, given the width of every tab.
+func firstTab(widths []int, active, width int) int {
+	first, w := 0, 0
+	for i := 0; i <= active && i < len(widths); i++ {
+		w += widths[i]
+	}
+	for w > width && first < active {
+		w -= widths[first]
+		first++
+	}
+	return first
+}
+
+// fitWidth returns as much of the start of rs as fits in width cells.
+func fitWidth(rs []rune, width int) []rune {
+	w := 0
+	for i, r := range rs {
+		if w += runeWidth(r); w > width {
+			return rs[:i]
+		}
+	}
+	return rs
+}
+
+// tabs returns the labels of the group's tabs, their widths in cells and
+// the index of the active one.
+func (g *group) tabs() (labels [][]rune, widths []int, active int) {
+	labels = make([][]rune, len(g.views))
+	widths = make([]int, len(g.views))
+	for i, v := range g.views {
+		label := tabLabel(v)
+		labels[i] = []rune(label)
+		widths[i] = stringWidth(label)
+		if v == g.active {
+			active = i
+		}
+	}
+	return
+}
+
+// tabAt returns the index of the tab drawn at column x, or -1.
+func (g *group) tabAt(x int) int {
+	_, widths, active := g.tabs()
+	tx := g.layout.x
+	for i := firstTab(widths, active, g.layout.width); i < len(widths); i++ {
+		if x >= tx && x < tx+widths[i] {
+			return i
+		}
+		tx += widths[i]
+	}
+	return -1
+}
+
+func (t *tbfe) renderTabs() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	inactiveBg := overlayBg
+	for gi, g := range t.groups {
+		l := g.layout
+		for x := l.x; x < l.x+l.width; x++ {
+			scr.SetCell(x, l.y, ' ', defaultFg, inactiveBg)
+		}
+
+		labels, widths, active := g.tabs()
+		x := l.x
+		for i := firstTab(widths, active, l.width); i < len(labels) && x < l.x+l.width; i++ {
+			fg, bg := defaultFg, inactiveBg
+			if i == active {
+				bg = defaultBg
+				if gi == t.activeGroup {
+					fg |= termbox.AttrBold
+				}
+			}
+			x = addRunes(x, l.y, fitWidth(labels[i], l.x+l.width-x), fg, bg)
+		}
+	}
+}
+
+// selectView shows the view at index i of the active group's tabs.
+// If wrap is set, indices out of range wrap around to the other end,
+// otherwise they are ignored.
+func (t *tbfe) selectView(i int, wrap bool) {
+	t.lock.Lock()
+	g := t.groups[t.activeGroup]
+	n := len(g.views)
+	if n == 0 || (!wrap && (i < 0 || i >= n)) {
+		t.lock.Unlock()
+		return
+	}
+	i = (i%n + n) % n
+	g.active = g.views[i]
+	t.currentView = g.active
+	v := g.active
+	t.lock.Unlock()
+
+	// Activating the view runs callbacks that call back into the
+	// frontend, so the lock mustn't be held
+	t.currentWindow.SetActiveView(v)
+	t.Show(v, t.VisibleRegion(v))
+}
+
+// activateView brings up view v in the group holding it and gives it
+// the input focus.
+func (t *tbfe) activateView(v *backend.View) {
+	t.lock.Lock()
+	i := t.groupOf(v)
+	if i < 0 {
+		t.lock.Unlock()
+		return
+	}
+	t.groups[i].active = v
+	t.lock.Unlock()
+	t.focusGroup(i)
+
+	t.Show(v, t.VisibleRegion(v))
+}
+
+// activeTab returns the index of the view shown in the active group.
+func (t *tbfe) activeTab() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	g := t.groups[t.activeGroup]
+	for i, v := range g.views {
+		if v == g.active {
+			return i
+		}
+	}
+	return 0
+}
+
+func (c *NextViewCommand) Run(w *backend.Window) error {
+	t := frontend()
+	if t == nil {
+		return errNoFrontend
+	}
+	t.selectView(t.activeTab()+1, true)
+	return nil
+}
+
+func (c *PrevViewCommand) Run(w *backend.Window) error {
+	t := frontend()
+	if t == nil {
+		return errNoFrontend
+	}
+	t.selectView(t.activeTab()-1, true)
+	return nil
+}
+
+func (c *SelectByIndexCommand) Init(args backend.Args) error {
+	c.Index = intArg(args, "index", 0)
+	return nil
+}
+
+func (c *SelectByIndexCommand) Run(w *backend.Window) error {
+	t := frontend()
+	if t == nil {
+		return errNoFrontend
+	}
+	t.selectView(c.Index, false)
+	return nil
+}
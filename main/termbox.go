@@ -1,64 +1,42 @@
 package main
 
 import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 
+	"github.com/limetext/backend"
 	"github.com/limetext/backend/keys"
+	"github.com/limetext/backend/log"
 	"github.com/limetext/backend/render"
+	"github.com/limetext/loaders"
+	. "github.com/limetext/text"
 	"github.com/lucasb-eyer/go-colorful"
+	"github.com/mattn/go-runewidth"
 	"github.com/nsf/termbox-go"
+	"golang.org/x/text/unicode/norm"
 )
 
 var (
+	// Keys reported by termbox, which mostly come from the terminal's
+	// terminfo entry. The keys sending control bytes are in ctrlKey.
 	lut = map[termbox.Key]keys.KeyPress{
-		// Omission of these are intentional due to map collisions
-		//		termbox.KeyCtrlTilde:      keys.KeyPress{Ctrl: true, Key: '~'},
-		//		termbox.KeyCtrlBackslash:  keys.KeyPress{Ctrl: true, Key: '\\'},
-		//		termbox.KeyCtrlSlash:      keys.KeyPress{Ctrl: true, Key: '/'},
-		//		termbox.KeyCtrlUnderscore: keys.KeyPress{Ctrl: true, Key: '_'},
-		//		termbox.KeyCtrlLsqBracket: keys.KeyPress{Ctrl: true, Key: '{'},
-		//		termbox.KeyCtrlRsqBracket: keys.KeyPress{Ctrl: true, Key: '}'},
-		// termbox.KeyCtrl3:
-		// termbox.KeyCtrl8
-		//		termbox.KeyCtrl2:      keys.KeyPress{Ctrl: true, Key: '2'},
-		termbox.KeyCtrlSpace:  {Ctrl: true, Key: ' '},
-		termbox.KeyCtrlA:      {Ctrl: true, Key: 'a'},
-		termbox.KeyCtrlB:      {Ctrl: true, Key: 'b'},
-		termbox.KeyCtrlC:      {Ctrl: true, Key: 'c'},
-		termbox.KeyCtrlD:      {Ctrl: true, Key: 'd'},
-		termbox.KeyCtrlE:      {Ctrl: true, Key: 'e'},
-		termbox.KeyCtrlF:      {Ctrl: true, Key: 'f'},
-		termbox.KeyCtrlG:      {Ctrl: true, Key: 'g'},
-		termbox.KeyCtrlH:      {Ctrl: true, Key: 'h'},
-		termbox.KeyCtrlJ:      {Ctrl: true, Key: 'j'},
-		termbox.KeyCtrlK:      {Ctrl: true, Key: 'k'},
-		termbox.KeyCtrlL:      {Ctrl: true, Key: 'l'},
-		termbox.KeyCtrlN:      {Ctrl: true, Key: 'n'},
-		termbox.KeyCtrlO:      {Ctrl: true, Key: 'o'},
-		termbox.KeyCtrlP:      {Ctrl: true, Key: 'p'},
-		termbox.KeyCtrlQ:      {Ctrl: true, Key: 'q'},
-		termbox.KeyCtrlR:      {Ctrl: true, Key: 'r'},
-		termbox.KeyCtrlS:      {Ctrl: true, Key: 's'},
-		termbox.KeyCtrlT:      {Ctrl: true, Key: 't'},
-		termbox.KeyCtrlU:      {Ctrl: true, Key: 'u'},
-		termbox.KeyCtrlV:      {Ctrl: true, Key: 'v'},
-		termbox.KeyCtrlW:      {Ctrl: true, Key: 'w'},
-		termbox.KeyCtrlX:      {Ctrl: true, Key: 'x'},
-		termbox.KeyCtrlY:      {Ctrl: true, Key: 'y'},
-		termbox.KeyCtrlZ:      {Ctrl: true, Key: 'z'},
-		termbox.KeyCtrl4:      {Ctrl: true, Key: '4'},
-		termbox.KeyCtrl5:      {Ctrl: true, Key: '5'},
-		termbox.KeyCtrl6:      {Ctrl: true, Key: '6'},
-		termbox.KeyCtrl7:      {Ctrl: true, Key: '7'},
-		termbox.KeyEnter:      {Key: keys.Enter},
-		termbox.KeySpace:      {Key: ' '},
-		termbox.KeyBackspace2: {Key: keys.Backspace},
 		termbox.KeyArrowUp:    {Key: keys.Up},
 		termbox.KeyArrowDown:  {Key: keys.Down},
 		termbox.KeyArrowLeft:  {Key: keys.Left},
 		termbox.KeyArrowRight: {Key: keys.Right},
+		termbox.KeyInsert:     {Key: keys.Insert},
 		termbox.KeyDelete:     {Key: keys.Delete},
-		termbox.KeyEsc:        {Key: keys.Escape},
+		termbox.KeyHome:       {Key: keys.Home},
+		termbox.KeyEnd:        {Key: keys.End},
+		termbox.KeySpace:      {Key: ' '},
 		termbox.KeyPgup:       {Key: keys.PageUp},
 		termbox.KeyPgdn:       {Key: keys.PageDown},
 		termbox.KeyF1:         {Key: keys.F1},
@@ -73,7 +51,6 @@ var (
 		termbox.KeyF10:        {Key: keys.F10},
 		termbox.KeyF11:        {Key: keys.F11},
 		termbox.KeyF12:        {Key: keys.F12},
-		termbox.KeyTab:        {Key: '\t'},
 	}
 
 	// xterm 256 colors
@@ -336,31 +313,465 @@ var (
 		"#e4e4e4",
 		"#eeeeee",
 	}
-	colorMap = map[string]termbox.Attribute{}
+	colorMap = map[paletteKey]termbox.Attribute{}
+
+	// The number of colours the terminal can show. Unless it's
+	// trueColors, colours are approximated by the closest of the first
+	// that many colours of the palette.
+	colors = 256
 
 	defaultBg = termbox.ColorBlack
 	defaultFg = termbox.ColorWhite
+
+	selectionBg       = termbox.ColorBlue
+	selectionBorderBg = termbox.ColorBlue
+
+	findHighlightBg = termbox.ColorYellow
+	findHighlightFg = termbox.ColorBlack
 )
 
+// The colours used until the colour scheme says otherwise
+var (
+	black  = render.Colour{0, 0, 0, 255}
+	white  = render.Colour{192, 192, 192, 255}
+	blue   = render.Colour{0, 0, 128, 255}
+	yellow = render.Colour{128, 128, 0, 255}
+)
+
+// selectionCursor walks the sorted regions of a view's selection
+// alongside the text being rendered, so that looking up the selection
+// state of consecutive offsets doesn't rescan every region.
+type selectionCursor struct {
+	regions []Region
+	carets  map[int]bool
+	i       int
+}
+
+func newSelectionCursor(regions []Region) *selectionCursor {
+	sc := &selectionCursor{regions: regions, carets: make(map[int]bool, len(regions))}
+	for _, r := range regions {
+		sc.carets[r.B] = true
+	}
+	return sc
+}
+
+// at reports whether offset o is inside a non-empty selection region and
+// whether it is the first or last selected cell of that region. Offsets
+// must be passed in increasing order.
+func (sc *selectionCursor) at(o int) (selected, border bool) {
+	for sc.i < len(sc.regions) && sc.regions[sc.i].End() <= o {
+		sc.i++
+	}
+	if sc.i == len(sc.regions) {
+		return false, false
+	}
+	r := sc.regions[sc.i]
+	if o < r.Begin() {
+		return false, false
+	}
+	return true, o == r.Begin() || o == r.End()-1
+}
+
+// caret reports whether a caret should be drawn at offset o.
+func (sc *selectionCursor) caret(o int) bool {
+	return sc.carets[o]
+}
+
+// recipeCursor walks the transcribed recipe of a view alongside the text
+// being rendered, so that the colours of consecutive offsets are found in
+// a single pass over both.
+type recipeCursor struct {
+	recipe render.TranscribedRecipe
+	i      int
+	// The first span that hash looks at
+	hi int
+	// The colours of span i, converted when it's first used
+	conv   int
+	fg, bg termbox.Attribute
+	// If set, style returns the font style attributes of the span
+	// starting at offset o, which are added to its foreground
+	style func(o int) termbox.Attribute
+}
+
+// newRecipeCursor returns a cursor over recipe. Its spans are sorted and
+// cut where they overlap, so that there's only one span at each offset.
+func newRecipeCursor(recipe render.TranscribedRecipe) *recipeCursor {
+	return &recipeCursor{recipe: cutRecipe(recipe), conv: -1}
+}
+
+// cutRecipe returns the spans of recipe sorted by where they begin, and
+// cut so that they don't overlap. Where they did, the span that begins
+// later is kept, or the one that comes later in recipe if they begin at
+// the same offset, so spans nested in others show.
+func cutRecipe(recipe render.TranscribedRecipe) render.TranscribedRecipe {
+	sorted := make(render.TranscribedRecipe, 0, len(recipe))
+	for _, u := range recipe {
+		if !u.Region.Empty() {
+			sorted = append(sorted, u)
+		}
+	}
+	sort.Stable(byBegin(sorted))
+
+	// The spans that have begun are stacked, and the top one is drawn
+	// until it ends or another one begins. Ended spans under the top one
+	// are only taken off when they're reached.
+	var (
+		ret   render.TranscribedRecipe
+		stack render.TranscribedRecipe
+		o     int
+	)
+	fill := func(to int) {
+		for o < to && len(stack) > 0 {
+			u := stack[len(stack)-1]
+			if u.Region.End() <= o {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			end := u.Region.End()
+			if end > to {
+				end = to
+			}
+			ret = append(ret, render.RenderUnit{Flavour: u.Flavour, Region: Region{A: o, B: end}})
+			o = end
+		}
+		o = to
+	}
+	last := 0
+	for _, u := range sorted {
+		fill(u.Region.Begin())
+		stack = append(stack, u)
+		if u.Region.End() > last {
+			last = u.Region.End()
+		}
+	}
+	fill(last)
+	return ret
+}
+
+type byBegin render.TranscribedRecipe
+
+func (b byBegin) Len() int           { return len(b) }
+func (b byBegin) Less(i, j int) bool { return b[i].Region.Begin() < b[j].Region.Begin() }
+func (b byBegin) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// at returns the colours of offset o, and false if no span of the recipe
+// covers it. Offsets must be passed in increasing order.
+func (rc *recipeCursor) at(o int) (fg, bg termbox.Attribute, ok bool) {
+	for rc.i < len(rc.recipe) && rc.recipe[rc.i].Region.End() <= o {
+		rc.i++
+	}
+	if rc.i == len(rc.recipe) || o < rc.recipe[rc.i].Region.Begin() {
+		return 0, 0, false
+	}
+	if rc.conv != rc.i {
+		f := rc.recipe[rc.i].Flavour
+		rc.fg = colorAttr(render.Colour(f.Foreground))
+		rc.bg = colorAttr(render.Colour(f.Background))
+		if rc.style != nil {
+			rc.fg |= rc.style(rc.recipe[rc.i].Region.Begin())
+		}
+		rc.conv = rc.i
+	}
+	return rc.fg, rc.bg, true
+}
+
+// hash returns a hash of the parts of the spans of the recipe inside r,
+// relative to its start, and their colours and font styles. Lines can be
+// drawn the same as before while their text and the hash don't change.
+// Regions must be passed in increasing order.
+func (rc *recipeCursor) hash(r Region) uint64 {
+	for rc.hi < len(rc.recipe) && rc.recipe[rc.hi].Region.End() <= r.Begin() {
+		rc.hi++
+	}
+	h := fnv.New64a()
+	var buf [4 * binary.MaxVarintLen64]byte
+	for _, u := range rc.recipe[rc.hi:] {
+		if u.Region.Begin() >= r.End() {
+			break
+		}
+		in := u.Region.Intersection(r)
+		if in.Empty() {
+			continue
+		}
+		f := u.Flavour
+		var style termbox.Attribute
+		if rc.style != nil {
+			style = rc.style(u.Region.Begin())
+		}
+		n := binary.PutUvarint(buf[:], uint64(in.Begin()-r.Begin()))
+		n += binary.PutUvarint(buf[n:], uint64(in.Size()))
+		n += binary.PutUvarint(buf[n:], uint64(style))
+		h.Write(buf[:n])
+		h.Write([]byte{
+			f.Foreground.R, f.Foreground.G, f.Foreground.B, f.Foreground.A,
+			f.Background.R, f.Background.G, f.Background.B, f.Background.A,
+		})
+	}
+	return h.Sum64()
+}
+
 func addString(x, y int, s string, fg, bg termbox.Attribute) int {
-	runes := []rune(s)
-	addRunes(x, y, runes, fg, bg)
-	x += len(runes)
+	return addRunes(x, y, []rune(s), fg, bg)
+}
+
+// addRunes draws runes starting at x, y and returns the x after them.
+func addRunes(x, y int, runes []rune, fg, bg termbox.Attribute) int {
+	for i := 0; i < len(runes); i++ {
+		if w := runeWidth(runes[i]); w > 0 {
+			r, n := cluster(runes, i)
+			scr.SetCell(x, y, r, fg, bg)
+			x += w
+			i += n - 1
+		}
+	}
 	return x
 }
 
-func addRunes(x, y int, runes []rune, fg, bg termbox.Attribute) {
-	for i, r := range runes {
-		termbox.SetCell(x+i, y, r, fg, bg)
+// cluster returns the rune to draw for rs[i] and the combining marks
+// following it, along with how many runes that is. A termbox cell only
+// holds one rune, so the marks are composed with rs[i] when there's a
+// precomposed rune for them, like é for e and U+0301, and left out when
+// there isn't.
+func cluster(rs []rune, i int) (rune, int) {
+	n := 1
+	for i+n < len(rs) && rs[i+n] != '\t' && runeWidth(rs[i+n]) == 0 {
+		n++
+	}
+	if n > 1 {
+		if c := []rune(norm.NFC.String(string(rs[i : i+n]))); len(c) == 1 {
+			return c[0], n
+		}
+	}
+	return rs[i], n
+}
+
+// runeWidth returns the number of cells r takes up on screen: 2 for wide
+// East Asian runes and most emoji, and 0 for combining marks and other
+// runes drawn together with the rune before them. Termbox has no way of
+// drawing those, so they're left out.
+func runeWidth(r rune) int {
+	return runewidth.RuneWidth(r)
+}
+
+// stringWidth returns the number of cells s takes up on screen.
+func stringWidth(s string) int {
+	return runewidth.StringWidth(s)
+}
+
+// isText reports whether kp types text, as opposed to being a special
+// key or a key combination.
+func isText(kp keys.KeyPress) bool {
+	if kp.Ctrl || kp.Alt || kp.Super || kp.Text == "" {
+		return false
+	}
+	switch kp.Key {
+	case keys.Enter, keys.Escape, keys.Backspace, keys.Delete, '\t',
+		keys.Up, keys.Down, keys.Left, keys.Right, keys.PageUp, keys.PageDown,
+		keys.F1, keys.F2, keys.F3, keys.F4, keys.F5, keys.F6,
+		keys.F7, keys.F8, keys.F9, keys.F10, keys.F11, keys.F12:
+		return false
+	}
+	return true
+}
+
+const trueColors = 1 << 24
+
+// paletteKey identifies the closest palette colour to col among the
+// first n palette colours.
+type paletteKey struct {
+	col render.Colour
+	n   int
+}
+
+// detectColors returns the number of colours to render with given the
+// colors flag, the TERM and COLORTERM environment variables and the
+// number of colours in the terminal's terminfo entry, which is 0 if it
+// isn't known.
+func detectColors(mode, term, colorterm string, terminfo int) int {
+	switch mode {
+	case "truecolor", "24bit":
+		return trueColors
+	case "256":
+		return 256
+	case "16":
+		return 16
+	case "8":
+		return 8
+	}
+
+	if colorterm == "truecolor" || colorterm == "24bit" {
+		return trueColors
+	}
+	switch {
+	case terminfo >= 256:
+		return 256
+	case terminfo >= 16:
+		return 16
+	case terminfo > 0:
+		return 8
+	}
+	switch {
+	case strings.Contains(term, "256color"):
+		return 256
+	case term == "linux", term == "dumb", strings.HasPrefix(term, "vt"):
+		return 8
+	case term == "":
+		return 256
+	}
+	return 16
+}
+
+// terminfoColors returns the number of colours of the terminal according
+// to terminfo, or 0 if it can't be found out.
+func terminfoColors() int {
+	out, err := exec.Command("tput", "colors").Output()
+	if err != nil {
+		return 0
 	}
+	n, _ := strconv.Atoi(strings.TrimSpace(string(out)))
+	return n
 }
 
 func setColorMode() {
-	termbox.SetOutputMode(termbox.Output256)
+	colors = detectColors(*colorMode, os.Getenv("TERM"), os.Getenv("COLORTERM"), terminfoColors())
+	switch colors {
+	case trueColors:
+		termbox.SetOutputMode(termbox.OutputRGB)
+	case 256:
+		termbox.SetOutputMode(termbox.Output256)
+	default:
+		termbox.SetOutputMode(termbox.OutputNormal)
+	}
+
+	defaultBg, defaultFg = colorAttr(black), colorAttr(white)
+	selectionBg, selectionBorderBg = colorAttr(blue), colorAttr(blue)
+	findHighlightBg, findHighlightFg = colorAttr(yellow), colorAttr(black)
+	overlayBg = colorAttr(overlayColour)
+}
+
+// fixContrast makes the backgrounds of selections, find matches and
+// panels stand out from the background of the views by reversing them,
+// when mapping the colour scheme to a few colours made them the same.
+func fixContrast() {
+	if selectionBg == defaultBg {
+		selectionBg |= termbox.AttrReverse
+	}
+	if selectionBorderBg == defaultBg {
+		selectionBorderBg = selectionBg
+	}
+	if findHighlightBg == defaultBg {
+		findHighlightBg |= termbox.AttrReverse
+	}
+	if overlayBg == defaultBg {
+		overlayBg |= termbox.AttrReverse
+	}
+}
+
+// fontStyles holds the font styles, such as "bold italic", a colour
+// scheme gives scopes. The colour schemes of the backend only keep the
+// colours, so the styles are read from the .tmTheme file again.
+type fontStyles struct {
+	Settings []struct {
+		Scope    string
+		Settings struct {
+			FontStyle string
+		}
+	}
+}
+
+var (
+	fontStylesLock sync.Mutex
+	// The font styles of each colour scheme file, or nil if it couldn't
+	// be loaded
+	schemeFontStyles = make(map[string]*fontStyles)
+)
+
+// loadFontStyles returns the font styles of the colour scheme at path,
+// which is only read the first time.
+func loadFontStyles(path string) *fontStyles {
+	fontStylesLock.Lock()
+	defer fontStylesLock.Unlock()
+	if fs, ok := schemeFontStyles[path]; ok {
+		return fs
+	}
+
+	fs := &fontStyles{}
+	if data, err := ioutil.ReadFile(path); err != nil {
+		log.Warn("Couldn't read the font styles of %s: %s", path, err)
+		fs = nil
+	} else if err := loaders.LoadPlist(data, fs); err != nil {
+		log.Warn("Couldn't load the font styles of %s: %s", path, err)
+		fs = nil
+	}
+	schemeFontStyles[path] = fs
+	return fs
+}
+
+// style returns the font style of scope. It's looked up the way the
+// backend looks up the colours of a scope, so that both come from the
+// same setting.
+func (fs *fontStyles) style(scope string) string {
+	if len(fs.Settings) == 0 {
+		return ""
+	}
+	for na := scope; len(na) > 0; {
+		sn := na
+		i := strings.LastIndex(sn, " ")
+		if i != -1 {
+			sn = sn[i+1:]
+		}
+		for _, s := range fs.Settings {
+			if s.Scope == sn {
+				return s.Settings.FontStyle
+			}
+		}
+		if i2 := strings.LastIndex(na, "."); i2 == -1 {
+			break
+		} else if i > i2 {
+			na = na[:i]
+		} else {
+			na = strings.TrimSpace(na[:i2])
+		}
+	}
+	return fs.Settings[0].Settings.FontStyle
+}
+
+// fontStyleAttr returns the termbox attributes for a font style. Italic
+// text is only shown as such if the terminal supports it.
+func fontStyleAttr(style string) (attr termbox.Attribute) {
+	for _, s := range strings.Fields(style) {
+		switch s {
+		case "bold":
+			attr |= termbox.AttrBold
+		case "italic":
+			attr |= termbox.AttrCursive
+		case "underline":
+			attr |= termbox.AttrUnderline
+		}
+	}
+	return
+}
+
+// colorAttr returns the termbox attribute for col in the current colour
+// mode.
+func colorAttr(col render.Colour) termbox.Attribute {
+	if colors == trueColors {
+		return termbox.RGBToAttribute(col.R, col.G, col.B)
+	}
+	return paletteColor(col, colors)
 }
 
 func color256(col render.Colour) termbox.Attribute {
-	if attr, ok := colorMap[col.String()]; ok {
+	return paletteColor(col, 256)
+}
+
+// paletteColor returns the attribute of the closest colour to col among
+// the first n colours of the palette. Termbox numbers both the 8 and 16
+// colours of its normal output mode and the 256 colours of its 256
+// colour mode in palette order, starting at 1.
+func paletteColor(col render.Colour, n int) termbox.Attribute {
+	key := paletteKey{col, n}
+	if attr, ok := colorMap[key]; ok {
 		return attr
 	}
 
@@ -371,7 +782,7 @@ func color256(col render.Colour) termbox.Attribute {
 	}
 	dist := float64(1)
 	found := 1
-	for i, hex := range palette {
+	for i, hex := range palette[:n] {
 		c2, _ := colorful.Hex(hex)
 		nd := c1.DistanceLab(c2)
 		if nd < dist {
@@ -381,7 +792,7 @@ func color256(col render.Colour) termbox.Attribute {
 	}
 
 	attr := termbox.Attribute(found)
-	colorMap[col.String()] = attr
+	colorMap[key] = attr
 
 	return attr
 }
@@ -408,17 +819,104 @@ func padLineRunes(line []rune, totalLineSize int) (padded []rune) {
 	return
 }
 
-func renderLineNumber(line, x *int, y, lineNumberRenderSize int, fg, bg termbox.Attribute) {
-	if *x == 0 {
-		lineRunes := padLineRunes(intToRunes(*line), lineNumberRenderSize)
+// viewTabSize returns the tab_size setting of v.
+func viewTabSize(v *backend.View) int {
+	if i, ok := v.Settings().Get("tab_size", 4).(int); ok && i > 0 {
+		return i
+	}
+	return 4
+}
+
+// gutterWidth returns the number of cells taken up by the line numbers
+// of v, if they are shown.
+func gutterWidth(v *backend.View) int {
+	if ln, _ := v.Settings().Get("line_numbers", true).(bool); !ln {
+		return 0
+	}
+	eofline, _ := v.RowCol(v.Size())
+	return len(intToRunes(eofline+1)) + 1
+}
+
+// tabStop returns the column a tab at col advances to.
+func tabStop(col, tabSize int) int {
+	return col + tabSize - col%tabSize
+}
+
+// nextCol returns the column after rune r drawn at column col.
+func nextCol(r rune, col, tabSize int) int {
+	if r == '\t' {
+		return tabStop(col, tabSize)
+	}
+	return col + runeWidth(r)
+}
 
-		for _, num := range lineRunes {
-			termbox.SetCell(*x, y, num, fg, bg)
-			*x++
+// colToOffset returns the index of the rune of line that is drawn at
+// col, counting from the start of the line, or len(line) if col is past
+// its end. Combining marks share the column of the rune before them.
+func colToOffset(line []rune, col, tabSize int) int {
+	c := 0
+	for i, r := range line {
+		next := nextCol(r, c, tabSize)
+		if col < next {
+			return i
 		}
+		c = next
+	}
+	return len(line)
+}
+
+// viewColumn returns the column at which point p of v is drawn, counting
+// from the start of its line.
+func viewColumn(v *backend.View, p int) int {
+	line := v.Substr(Region{v.Line(p).Begin(), p})
+	return textWidth([]rune(line), viewTabSize(v))
+}
+
+// textWidth returns the column after line, which is where the caret is
+// drawn if it's at the end of line.
+func textWidth(line []rune, tabSize int) int {
+	c := 0
+	for _, r := range line {
+		c = nextCol(r, c, tabSize)
+	}
+	return c
+}
+
+func statusRight(tabSize int) string {
+	return fmt.Sprintf("Tab Size:%d   %s", tabSize, "Go")
+}
 
-		*line++
+// renderLineNumber draws the number of line at x, y and returns the x
+// after it.
+func renderLineNumber(x, y, line, lineNumberRenderSize int, fg, bg termbox.Attribute) int {
+	return addRunes(x, y, padLineRunes(intToRunes(line), lineNumberRenderSize), fg, bg)
+}
+
+// renderClipMarks marks the edges of the text on row y, which goes from
+// column left up to right, where the line drawn there goes on past them.
+func renderClipMarks(y, left, right int, clipLeft, clipRight bool) {
+	if clipLeft {
+		scr.SetCell(left, y, '<', defaultFg, overlayBg)
+	}
+	if clipRight {
+		scr.SetCell(right-1, y, '>', defaultFg, overlayBg)
+	}
+}
+
+// scrollColumn returns the horizontal scroll offset at which column col
+// is visible in text that is width columns wide and is scrolled to scroll
+// now. The columns at the edges are avoided as they may be clip marks.
+func scrollColumn(scroll, col, width int) int {
+	if col >= scroll+width-1 {
+		scroll = col - width + 2
+	}
+	if col <= scroll {
+		scroll = col - 1
+	}
+	if scroll < 0 {
+		scroll = 0
 	}
+	return scroll
 }
 
 func getCaretStyle(style string, inverse bool) termbox.Attribute {
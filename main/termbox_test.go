@@ -1,9 +1,12 @@
 package main
 
 import (
+	"reflect"
 	"testing"
 
+	"github.com/limetext/backend"
 	"github.com/limetext/backend/render"
+	. "github.com/limetext/text"
 	"github.com/nsf/termbox-go"
 )
 
@@ -23,3 +26,311 @@ func TestColourToTermbox(t *testing.T) {
 		}
 	}
 }
+
+func TestDetectColors(t *testing.T) {
+	tests := []struct {
+		mode, term, colorterm string
+		terminfo              int
+		exp                   int
+	}{
+		{"auto", "xterm-256color", "truecolor", 256, trueColors},
+		{"auto", "xterm-256color", "24bit", 256, trueColors},
+		{"auto", "xterm-256color", "", 256, 256},
+		{"auto", "xterm", "", 8, 8},
+		{"auto", "rxvt", "", 88, 16},
+		{"auto", "linux", "", 0, 8},
+		{"auto", "vt220", "", 0, 8},
+		{"auto", "screen-256color", "", 0, 256},
+		{"auto", "xterm", "", 0, 16},
+		{"truecolor", "linux", "", 8, trueColors},
+		{"256", "xterm", "truecolor", 8, 256},
+		{"16", "xterm-256color", "", 256, 16},
+		{"8", "xterm-256color", "", 256, 8},
+	}
+
+	for i, test := range tests {
+		if n := detectColors(test.mode, test.term, test.colorterm, test.terminfo); n != test.exp {
+			t.Errorf("Test %d: Expected %d, but got %d", i, test.exp, n)
+		}
+	}
+}
+
+func TestColorAttr(t *testing.T) {
+	defer func() { colors = 256 }()
+
+	tests := []struct {
+		colors int
+		colour render.Colour
+		exp    termbox.Attribute
+	}{
+		{256, render.Colour{R: 28, G: 29, B: 26}, termbox.Attribute(235)},
+		{16, render.Colour{R: 28, G: 29, B: 26}, termbox.ColorBlack},
+		{16, render.Colour{R: 240, G: 240, B: 240}, termbox.Attribute(16)},
+		{16, render.Colour{R: 140, G: 0, B: 0}, termbox.ColorRed},
+		{8, render.Colour{R: 240, G: 240, B: 240}, termbox.ColorWhite},
+		{8, render.Colour{R: 0, G: 0, B: 230}, termbox.ColorBlue},
+	}
+
+	for i, test := range tests {
+		colors = test.colors
+		if attr := colorAttr(test.colour); attr != test.exp {
+			t.Errorf("Test %d: Expected %v, but got %v", i, test.exp, attr)
+		}
+	}
+
+	colors = trueColors
+	if r, g, b := termbox.AttributeToRGB(colorAttr(render.Colour{R: 28, G: 29, B: 26})); r != 28 || g != 29 || b != 26 {
+		t.Errorf("Expected 28, 29, 26 in truecolor mode, but got %d, %d, %d", r, g, b)
+	}
+}
+
+func TestSchemeContrast(t *testing.T) {
+	old := []termbox.Attribute{defaultFg, defaultBg, selectionBg, selectionBorderBg, findHighlightBg, findHighlightFg, overlayBg}
+	defer func() {
+		defaultFg, defaultBg, selectionBg, selectionBorderBg, findHighlightBg, findHighlightFg, overlayBg = old[0], old[1], old[2], old[3], old[4], old[5], old[6]
+	}()
+
+	// As when every colour maps to black with 8 colours, and there's no
+	// colour scheme to take the colours from
+	defaultBg, selectionBg, findHighlightBg, overlayBg = termbox.ColorBlack, termbox.ColorBlack, termbox.ColorBlack, termbox.ColorBlack
+	ed := backend.GetEditor()
+	ed.Settings().Set("color_scheme", "")
+	setSchemeSettings(ed)
+	for name, bg := range map[string]termbox.Attribute{"selection": selectionBg, "find highlight": findHighlightBg, "overlay": overlayBg} {
+		if bg == defaultBg {
+			t.Errorf("Expected the %s background to differ from the default %v", name, defaultBg)
+		}
+	}
+}
+
+func TestFontStyleAttr(t *testing.T) {
+	tests := []struct {
+		style string
+		exp   termbox.Attribute
+	}{
+		{"", 0},
+		{"bold", termbox.AttrBold},
+		{"italic", termbox.AttrCursive},
+		{" bold  underline", termbox.AttrBold | termbox.AttrUnderline},
+		{"italic bold underline", termbox.AttrCursive | termbox.AttrBold | termbox.AttrUnderline},
+		{"strikethrough", 0},
+	}
+
+	for i, test := range tests {
+		if attr := fontStyleAttr(test.style); attr != test.exp {
+			t.Errorf("Test %d: Expected %v, but got %v", i, test.exp, attr)
+		}
+	}
+}
+
+const twilight = "testdata/packages/Twilight/Twilight.tmTheme"
+
+func TestFontStyles(t *testing.T) {
+	fs := loadFontStyles(twilight)
+	if fs == nil {
+		t.Fatalf("Expected the font styles of %s to load", twilight)
+	}
+	tests := []struct {
+		scope, exp string
+	}{
+		{"source.go comment.line.double-slash.go", "italic"},
+		{"source.go invalid.deprecated.go", "italic underline"},
+		{"source.go keyword.control.go", ""},
+		{"source.go", ""},
+	}
+
+	for i, test := range tests {
+		if style := fs.style(test.scope); style != test.exp {
+			t.Errorf("Test %d: Expected %q, but got %q", i, test.exp, style)
+		}
+	}
+}
+
+func TestRenderFontStyles(t *testing.T) {
+	s := newMemScreen(10, 1)
+	old := scr
+	scr = s
+	defer func() { scr = old }()
+
+	w := backend.GetEditor().NewWindow()
+	defer w.Close()
+	v := w.NewFile()
+	defer func() {
+		v.SetScratch(true)
+		v.Close()
+	}()
+	e := v.BeginEdit()
+	v.Insert(e, 0, "x // y")
+	v.EndEdit(e)
+	v.Settings().Set("line_numbers", false)
+
+	lr := newLineRenderer(backend.GetEditor(), v, layout{width: 10, height: 1, visible: Region{0, v.Size()}})
+	lr.sc, lr.hc = newSelectionCursor(nil), newSelectionCursor(nil)
+	green := render.Colour{G: 140, A: 255}
+	lr.rc = newRecipeCursor(render.TranscribedRecipe{
+		{Flavour: render.Flavour{Foreground: green}, Region: Region{A: 0, B: 1}},
+		{Flavour: render.Flavour{Foreground: green}, Region: Region{A: 2, B: 6}},
+	})
+	// The scopes the Go syntax gives the spans
+	fs := loadFontStyles(twilight)
+	scopes := map[int]string{0: "source.go", 2: "source.go comment.line.double-slash.go"}
+	lr.rc.style = func(o int) termbox.Attribute {
+		return fontStyleAttr(fs.style(scopes[o]))
+	}
+	lr.renderLine(viewLine{region: Region{A: 0, B: 6}, text: "x // y", n: 1})
+
+	for x, c := range s.CellBuffer()[:6] {
+		italic := c.Fg&termbox.AttrCursive != 0
+		if exp := x >= 2; italic != exp {
+			t.Errorf("Expected cell %d to be italic: %v, but got %v", x, exp, italic)
+		}
+		if c.Fg&^termbox.AttrCursive != colorAttr(green) && x != 1 {
+			t.Errorf("Expected cell %d to keep its colour, but got %v", x, c.Fg)
+		}
+	}
+}
+
+func TestScrollColumn(t *testing.T) {
+	tests := []struct {
+		scroll, col int
+		exp         int
+	}{
+		{0, 0, 0},
+		{0, 5, 0},
+		{0, 8, 0},
+		{0, 9, 1},
+		{0, 30, 22},
+		{5, 6, 5},
+		{5, 5, 4},
+		{1, 0, 0},
+		{20, 3, 2},
+	}
+
+	for i, test := range tests {
+		if scroll := scrollColumn(test.scroll, test.col, 10); scroll != test.exp {
+			t.Errorf("Test %d: Expected %d, but got %d", i, test.exp, scroll)
+		}
+	}
+}
+
+func TestRecipeCursor(t *testing.T) {
+	red, blue := render.Colour{R: 140, A: 255}, render.Colour{B: 140, A: 255}
+	rc := newRecipeCursor(render.TranscribedRecipe{
+		{Flavour: render.Flavour{Foreground: red, Background: blue}, Region: Region{A: 0, B: 3}},
+		{Flavour: render.Flavour{Foreground: blue, Background: red}, Region: Region{A: 5, B: 8}},
+	})
+	r, b := colorAttr(red), colorAttr(blue)
+	tests := []struct {
+		o      int
+		fg, bg termbox.Attribute
+		ok     bool
+	}{
+		{0, r, b, true},
+		{2, r, b, true},
+		{3, 0, 0, false},
+		{4, 0, 0, false},
+		{5, b, r, true},
+		{7, b, r, true},
+		{8, 0, 0, false},
+		{20, 0, 0, false},
+	}
+
+	for i, test := range tests {
+		fg, bg, ok := rc.at(test.o)
+		if fg != test.fg || bg != test.bg || ok != test.ok {
+			t.Errorf("Test %d: Expected %v, %v, %v, but got %v, %v, %v", i, test.fg, test.bg, test.ok, fg, bg, ok)
+		}
+	}
+}
+
+func TestCutRecipe(t *testing.T) {
+	fa := render.Flavour{Foreground: render.Colour{R: 140, A: 255}}
+	fb := render.Flavour{Foreground: render.Colour{G: 140, A: 255}}
+	fc := render.Flavour{Foreground: render.Colour{B: 140, A: 255}}
+	a := func(x, y int) render.RenderUnit { return render.RenderUnit{Flavour: fa, Region: Region{A: x, B: y}} }
+	b := func(x, y int) render.RenderUnit { return render.RenderUnit{Flavour: fb, Region: Region{A: x, B: y}} }
+	c := func(x, y int) render.RenderUnit { return render.RenderUnit{Flavour: fc, Region: Region{A: x, B: y}} }
+
+	tests := []struct {
+		recipe, exp render.TranscribedRecipe
+	}{
+		{nil, nil},
+		{render.TranscribedRecipe{a(0, 3), b(5, 8)}, render.TranscribedRecipe{a(0, 3), b(5, 8)}},
+		{render.TranscribedRecipe{b(5, 8), a(0, 3)}, render.TranscribedRecipe{a(0, 3), b(5, 8)}},
+		{render.TranscribedRecipe{a(2, 2), b(5, 8)}, render.TranscribedRecipe{b(5, 8)}},
+		// Spans nested in others are cut out of them
+		{render.TranscribedRecipe{a(0, 11), b(3, 5)}, render.TranscribedRecipe{a(0, 3), b(3, 5), a(5, 11)}},
+		{render.TranscribedRecipe{b(3, 5), a(0, 11)}, render.TranscribedRecipe{a(0, 3), b(3, 5), a(5, 11)}},
+		{render.TranscribedRecipe{a(0, 5), b(3, 8)}, render.TranscribedRecipe{a(0, 3), b(3, 8)}},
+		{render.TranscribedRecipe{a(0, 10), b(2, 4), c(3, 6)}, render.TranscribedRecipe{a(0, 2), b(2, 3), c(3, 6), a(6, 10)}},
+		{render.TranscribedRecipe{a(0, 10), b(2, 4), c(6, 8)}, render.TranscribedRecipe{a(0, 2), b(2, 4), a(4, 6), c(6, 8), a(8, 10)}},
+		// Of spans beginning together the later one is kept
+		{render.TranscribedRecipe{b(0, 1), a(0, 11)}, render.TranscribedRecipe{a(0, 11)}},
+		{render.TranscribedRecipe{a(0, 11), b(0, 1)}, render.TranscribedRecipe{b(0, 1), a(1, 11)}},
+	}
+
+	for i, test := range tests {
+		if r := cutRecipe(test.recipe); !reflect.DeepEqual(r, test.exp) {
+			t.Errorf("Test %d: Expected %v, but got %v", i, test.exp, r)
+		}
+	}
+}
+
+func TestRecipeCursorOverlap(t *testing.T) {
+	red, blue := render.Colour{R: 140, A: 255}, render.Colour{B: 140, A: 255}
+	rc := newRecipeCursor(render.TranscribedRecipe{
+		{Flavour: render.Flavour{Foreground: red, Background: blue}, Region: Region{A: 0, B: 10}},
+		{Flavour: render.Flavour{Foreground: blue, Background: red}, Region: Region{A: 2, B: 4}},
+	})
+	r, b := colorAttr(red), colorAttr(blue)
+	tests := []struct {
+		o      int
+		fg, bg termbox.Attribute
+	}{
+		{0, r, b},
+		{2, b, r},
+		{3, b, r},
+		{4, r, b},
+		{9, r, b},
+	}
+
+	for i, test := range tests {
+		fg, bg, ok := rc.at(test.o)
+		if fg != test.fg || bg != test.bg || !ok {
+			t.Errorf("Test %d: Expected %v, %v, but got %v, %v, %v", i, test.fg, test.bg, fg, bg, ok)
+		}
+	}
+}
+
+func TestRecipeHash(t *testing.T) {
+	red, blue := render.Colour{R: 140, A: 255}, render.Colour{B: 140, A: 255}
+	unit := func(fg render.Colour, a, b int) render.RenderUnit {
+		return render.RenderUnit{Flavour: render.Flavour{Foreground: fg, Background: blue}, Region: Region{A: a, B: b}}
+	}
+	line := Region{A: 10, B: 20}
+	exp := newRecipeCursor(render.TranscribedRecipe{unit(red, 0, 12), unit(blue, 15, 17)}).hash(line)
+
+	tests := []struct {
+		recipe render.TranscribedRecipe
+		same   bool
+	}{
+		// Only the parts inside the line count
+		{render.TranscribedRecipe{unit(red, 5, 12), unit(blue, 15, 17), unit(red, 20, 30)}, true},
+		{render.TranscribedRecipe{unit(red, 0, 12), unit(red, 15, 17)}, false},
+		{render.TranscribedRecipe{unit(red, 0, 12), unit(blue, 15, 18)}, false},
+		{render.TranscribedRecipe{unit(red, 0, 12)}, false},
+		{nil, false},
+	}
+
+	for i, test := range tests {
+		if h := newRecipeCursor(test.recipe).hash(line); (h == exp) != test.same {
+			t.Errorf("Test %d: Expected the hash to be the same: %v, but got %v", i, test.same, h == exp)
+		}
+	}
+
+	// The same spans further on in the view give the same hash
+	moved := newRecipeCursor(render.TranscribedRecipe{unit(red, 30, 32), unit(blue, 35, 37)})
+	if h := moved.hash(Region{A: 30, B: 40}); h != exp {
+		t.Errorf("Expected the hash of the moved line to be %v, but got %v", exp, h)
+	}
+}
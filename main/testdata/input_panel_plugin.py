@@ -0,0 +1,17 @@
+import sublime
+import sublime_plugin
+
+
+class AskCommand(sublime_plugin.WindowCommand):
+
+    def run(self):
+        self.panel = self.window.show_input_panel(
+            "Name:", "foo", self.on_done, None, None)
+
+    def on_done(self, text):
+        self.window.settings().set("answer", text)
+
+cmd = AskCommand(sublime.active_window())
+cmd.run()
+if cmd.panel is None:
+    raise Exception("show_input_panel didn't return the view of the panel")
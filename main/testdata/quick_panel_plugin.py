@@ -0,0 +1,13 @@
+import sublime
+import sublime_plugin
+
+
+class PickCommand(sublime_plugin.WindowCommand):
+
+    def run(self):
+        self.window.show_quick_panel(["foo", ["bar", "baz"]], self.on_done)
+
+    def on_done(self, index):
+        self.window.settings().set("picked", index)
+
+PickCommand(sublime.active_window()).run()
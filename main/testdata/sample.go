@@ -0,0 +1,6 @@
+package sample
+
+// Greet says hello to 世界.
+func Greet() string {
+	return "hello, world, and a line long enough to run past the edge"
+}
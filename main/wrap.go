@@ -0,0 +1,215 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+
+	"github.com/limetext/backend"
+	. "github.com/limetext/text"
+)
+
+type (
+	// wrapConfig is how the lines of a view are soft wrapped.
+	wrapConfig struct {
+		width   int
+		tabSize int
+		// Whether wrapped rows are indented like the start of the line
+		indent bool
+	}
+
+	// wrapRow is a row of a soft wrapped line. start is the index of its
+	// first rune in the line, and col the column it's drawn at.
+	wrapRow struct {
+		start int
+		col   int
+	}
+)
+
+// wordWrap reports whether word_wrap is on for v. Like in sublime, it may
+// be "auto", which wraps text but not source code.
+func wordWrap(v *backend.View) bool {
+	switch wrap := v.Settings().Get("word_wrap", false).(type) {
+	case bool:
+		return wrap
+	case string:
+		return wrap == "auto" && !strings.HasPrefix(v.ScopeName(0), "source")
+	}
+	return false
+}
+
+// viewWrap returns how the lines of v are wrapped when laid out as l, or
+// false if word_wrap is off. The lines are wrapped at the edge of the
+// view, or at wrap_width if that's set and narrower.
+func viewWrap(v *backend.View, l layout) (wc wrapConfig, ok bool) {
+	if !wordWrap(v) {
+		return wc, false
+	}
+	wc.width = l.width - gutterWidth(v)
+	if ww, _ := v.Settings().Get("wrap_width", 0).(int); ww > 0 && ww < wc.width {
+		wc.width = ww
+	}
+	if wc.width <= 0 {
+		return wc, false
+	}
+	wc.tabSize = viewTabSize(v)
+	wc.indent, _ = v.Settings().Get("indent_subsequent_lines", true).(bool)
+	return wc, true
+}
+
+// rows splits line, which doesn't include its line break, into the rows
+// it's drawn in. Lines are broken after the last space or tab that fits,
+// not counting the indentation, or in the middle of words that don't fit
+// in a row of their own. Spaces don't start a row, but are left hanging
+// past the end of the previous one.
+func (wc wrapConfig) rows(line []rune) []wrapRow {
+	rows := []wrapRow{{0, 0}}
+
+	lead, indent := 0, 0
+	for ; lead < len(line); lead++ {
+		if r := line[lead]; r != ' ' && r != '\t' {
+			break
+		}
+		indent = nextCol(line[lead], indent, wc.tabSize)
+	}
+	if !wc.indent || indent > wc.width/2 {
+		indent = 0
+	}
+
+	col, brk := 0, -1
+	for i, r := range line {
+		next := nextCol(r, col, wc.tabSize)
+		space := r == ' ' || r == '\t'
+		for !space && next > wc.width && i > rows[len(rows)-1].start {
+			start := i
+			if brk > rows[len(rows)-1].start {
+				start = brk
+			}
+			rows = append(rows, wrapRow{start, indent})
+			col, brk = indent, -1
+			for _, r := range line[start:i] {
+				col = nextCol(r, col, wc.tabSize)
+			}
+			next = nextCol(r, col, wc.tabSize)
+		}
+		col = next
+		if space && i >= lead {
+			brk = i + 1
+		}
+	}
+	return rows
+}
+
+// row returns the line of v holding point p, its rows and the index of
+// the row p is drawn in.
+func (wc wrapConfig) row(v *backend.View, p int) (Region, []wrapRow, int) {
+	line := v.Line(p)
+	rows := wc.rows([]rune(v.Substr(line)))
+	return line, rows, rowAt(rows, p-line.Begin())
+}
+
+// rowAt returns the index of the row of rows that rune i is drawn in.
+func rowAt(rows []wrapRow, i int) int {
+	n := 0
+	for n+1 < len(rows) && rows[n+1].start <= i {
+		n++
+	}
+	return n
+}
+
+// scroll returns the start of the row n rows after the one point p of v
+// is drawn in, or before it if n is negative, and how many rows that
+// actually is. It stops at the first and last rows of v.
+func (wc wrapConfig) scroll(v *backend.View, p, n int) (int, int) {
+	line, rows, i := wc.row(v, p)
+	from := i
+	i += n
+	for i < 0 && line.Begin() > 0 {
+		line = v.Line(line.Begin() - 1)
+		rows = wc.rows([]rune(v.Substr(line)))
+		i += len(rows)
+		from += len(rows)
+	}
+	for i >= len(rows) && line.End() < v.Size() {
+		i -= len(rows)
+		from -= len(rows)
+		line = v.Line(line.End() + 1)
+		rows = wc.rows([]rune(v.Substr(line)))
+	}
+	if i < 0 {
+		i = 0
+	} else if i >= len(rows) {
+		i = len(rows) - 1
+	}
+	return line.Begin() + rows[i].start, i - from
+}
+
+// rowEnd returns the last point of v drawn in the row point p is in.
+func (wc wrapConfig) rowEnd(v *backend.View, p int) int {
+	line, rows, i := wc.row(v, p)
+	if i+1 < len(rows) {
+		return line.Begin() + rows[i+1].start - 1
+	}
+	return line.End()
+}
+
+// clip returns the region of v shown in h rows starting with the row
+// point s is drawn in. Like tbfe.clip, rows are added before it if v
+// ends first. The view can start and end in the middle of a line, so
+// lines taller than it can be scrolled through.
+func (wc wrapConfig) clip(v *backend.View, s, h int) Region {
+	if h < 1 {
+		h = 1
+	}
+	s, _ = wc.scroll(v, s, 0)
+	e, n := wc.scroll(v, s, h-1)
+	if n < h-1 {
+		s, _ = wc.scroll(v, s, n-h+1)
+	}
+	return Region{s, wc.rowEnd(v, e)}
+}
+
+// show returns the region of v to show in h rows so that r is visible,
+// when vis is shown now. The view is scrolled as little as possible, and
+// the end of r is shown if it doesn't all fit.
+func (wc wrapConfig) show(v *backend.View, vis, r Region, h int) Region {
+	s, _ := wc.scroll(v, vis.Begin(), 0)
+	if b, _ := wc.scroll(v, r.Begin(), 0); b < s {
+		s = b
+	}
+	if e, _ := wc.scroll(v, r.End(), 1-h); e > s {
+		s = e
+	}
+	return wc.clip(v, s, h)
+}
+
+// pointAt returns the text point drawn at column col of row dy, counting
+// from the top of the visible region vis.
+func (wc wrapConfig) pointAt(v *backend.View, vis Region, dy, col int) int {
+	line, rows, i := wc.row(v, vis.Begin())
+	dy += i
+	for dy >= len(rows) {
+		if line.End() >= v.Size() {
+			return v.Size()
+		}
+		dy -= len(rows)
+		line = v.Line(line.End() + 1)
+		rows = wc.rows([]rune(v.Substr(line)))
+	}
+	text := []rune(v.Substr(line))
+	end := len(text)
+	if dy+1 < len(rows) {
+		end = rows[dy+1].start
+	}
+	i, c := rows[dy].start, rows[dy].col
+	for ; i < end; i++ {
+		next := nextCol(text[i], c, wc.tabSize)
+		if col < next {
+			break
+		}
+		c = next
+	}
+	return line.Begin() + i
+}
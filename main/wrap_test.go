@@ -0,0 +1,200 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/limetext/backend"
+	. "github.com/limetext/text"
+)
+
+func TestWrapRows(t *testing.T) {
+	tests := []struct {
+		line   string
+		indent bool
+		exp    []wrapRow
+	}{
+		{"", true, []wrapRow{{0, 0}}},
+		{"hello", true, []wrapRow{{0, 0}}},
+		{"hello world", true, []wrapRow{{0, 0}, {6, 0}}},
+		{"hello world foo", true, []wrapRow{{0, 0}, {6, 0}}},
+		{"abcdefghijklmno", true, []wrapRow{{0, 0}, {10, 0}}},
+		// Spaces hang past the end of the row
+		{"abcd efgh   ijk", true, []wrapRow{{0, 0}, {12, 0}}},
+		{"  ab cd ef gh", true, []wrapRow{{0, 0}, {11, 2}}},
+		{"  ab cd ef gh", false, []wrapRow{{0, 0}, {11, 0}}},
+		{"\tabcdefgh", true, []wrapRow{{0, 0}, {7, 4}}},
+		{"\tab cdefghijkl", true, []wrapRow{{0, 0}, {4, 4}, {10, 4}}},
+		// Indentation wider than half the row isn't kept
+		{"        abcd", true, []wrapRow{{0, 0}, {10, 0}}},
+		{"日本語日本語", true, []wrapRow{{0, 0}, {5, 0}}},
+	}
+
+	for i, test := range tests {
+		wc := wrapConfig{width: 10, tabSize: 4, indent: test.indent}
+		if rows := wc.rows([]rune(test.line)); !reflect.DeepEqual(rows, test.exp) {
+			t.Errorf("Test %d: Expected %v, but got %v", i, test.exp, rows)
+		}
+	}
+}
+
+func TestWordWrap(t *testing.T) {
+	v, _, done := wrapView()
+	defer done()
+
+	// The view has no syntax, so it isn't source code
+	tests := []struct {
+		wrap interface{}
+		exp  bool
+	}{
+		{true, true},
+		{false, false},
+		{"auto", true},
+		{"always", false},
+		{1, false},
+	}
+
+	for i, test := range tests {
+		v.Settings().Set("word_wrap", test.wrap)
+		if wrap := wordWrap(v); wrap != test.exp {
+			t.Errorf("Test %d: Expected %v for %v, but got %v", i, test.exp, test.wrap, wrap)
+		}
+	}
+}
+
+// wrapView returns a view whose first line is wrapped in 4 rows, starting
+// at 0, 5, 10 and 15, by wc, and whose second line starts at 20.
+func wrapView() (*backend.View, wrapConfig, func()) {
+	w := backend.GetEditor().NewWindow()
+	v := w.NewFile()
+	e := v.BeginEdit()
+	v.Insert(e, 0, "aaaa bbbb cccc dddd\nee")
+	v.EndEdit(e)
+	return v, wrapConfig{width: 5, tabSize: 4}, func() {
+		v.SetScratch(true)
+		v.Close()
+		w.Close()
+	}
+}
+
+func TestWrapScroll(t *testing.T) {
+	v, wc, done := wrapView()
+	defer done()
+
+	tests := []struct {
+		p, n   int
+		exp, m int
+	}{
+		{7, 0, 5, 0},
+		{7, 1, 10, 1},
+		{0, -1, 0, 0},
+		{12, 3, 20, 2},
+		{20, -2, 10, -2},
+		{21, 10, 20, 0},
+	}
+
+	for i, test := range tests {
+		if p, m := wc.scroll(v, test.p, test.n); p != test.exp || m != test.m {
+			t.Errorf("Test %d: Expected %d, %d, but got %d, %d", i, test.exp, test.m, p, m)
+		}
+	}
+}
+
+func TestWrapClip(t *testing.T) {
+	v, wc, done := wrapView()
+	defer done()
+
+	tests := []struct {
+		s, h int
+		exp  Region
+	}{
+		{0, 5, Region{0, 22}},
+		{5, 2, Region{5, 14}},
+		{7, 1, Region{5, 9}},
+		// Rows are added before s when the view ends first
+		{15, 3, Region{10, 22}},
+	}
+
+	for i, test := range tests {
+		if r := wc.clip(v, test.s, test.h); r != test.exp {
+			t.Errorf("Test %d: Expected %v, but got %v", i, test.exp, r)
+		}
+	}
+}
+
+func TestWrapShow(t *testing.T) {
+	v, wc, done := wrapView()
+	defer done()
+
+	tests := []struct {
+		vis, r Region
+		exp    Region
+	}{
+		{Region{0, 9}, Region{17, 17}, Region{10, 19}},
+		{Region{10, 19}, Region{2, 2}, Region{0, 9}},
+		{Region{5, 14}, Region{7, 12}, Region{5, 14}},
+		// The end of a region taller than the view is shown
+		{Region{0, 9}, Region{0, 17}, Region{10, 19}},
+	}
+
+	for i, test := range tests {
+		if r := wc.show(v, test.vis, test.r, 2); r != test.exp {
+			t.Errorf("Test %d: Expected %v, but got %v", i, test.exp, r)
+		}
+	}
+}
+
+func TestWrapPointAt(t *testing.T) {
+	v, wc, done := wrapView()
+	defer done()
+
+	tests := []struct {
+		vis     Region
+		dy, col int
+		exp     int
+	}{
+		{Region{0, 22}, 0, 2, 2},
+		{Region{0, 22}, 4, 1, 21},
+		{Region{10, 22}, 1, 2, 17},
+		{Region{10, 22}, 2, 5, 22},
+		{Region{10, 22}, 3, 0, 22},
+	}
+
+	for i, test := range tests {
+		if p := wc.pointAt(v, test.vis, test.dy, test.col); p != test.exp {
+			t.Errorf("Test %d: Expected %d, but got %d", i, test.exp, p)
+		}
+	}
+}
+
+func TestRenderSkippedRows(t *testing.T) {
+	v, wc, done := wrapView()
+	defer done()
+	s := newMemScreen(6, 2)
+	old := scr
+	scr = s
+	defer func() { scr = old }()
+
+	lr := newLineRenderer(backend.GetEditor(), v, layout{width: 6, height: 2})
+	lr.lineNumbers, lr.tx, lr.lx = false, 0, 0
+	lr.wc, lr.wrap = wc, true
+	lr.rc = newRecipeCursor(nil)
+	lr.sc, lr.hc = newSelectionCursor(nil), newSelectionCursor(nil)
+	text := v.Substr(v.Line(0))
+	lr.renderLine(viewLine{region: v.Line(0), text: text, rows: wc.rows([]rune(text)), skip: 2, n: 2})
+
+	// Only the last two rows of the line are drawn
+	exp := []string{"cccc  ", "dddd  "}
+	cells := s.CellBuffer()
+	for y, row := range exp {
+		for x, r := range row {
+			if c := cells[y*6+x]; c.Ch != r && !(r == ' ' && c.Ch == 0) {
+				t.Errorf("Expected %q at %d, %d, but got %q", r, x, y, c.Ch)
+			}
+		}
+	}
+}